@@ -38,12 +38,48 @@ type smtpConfig struct {
 	Password string `yaml:"password"`
 }
 
+// registrationConfig 动态客户端注册配置
+type registrationConfig struct {
+	Enabled              bool     `yaml:"enabled"`
+	InitialAccessTokens  []string `yaml:"initial_access_tokens"`  // 注册时需要提供的初始访问令牌
+	AllowAnonymous       bool     `yaml:"allow_anonymous"`        // 未配置初始访问令牌时是否允许任何人注册
+	AllowedScopes        []string `yaml:"allowed_scopes"`         // 注册的客户端可以获得的权限，申请的权限范围与之取交集
+	PrivilegedGrantTypes []string `yaml:"privileged_grant_types"` // 允许注册的客户端使用的 client_credentials、令牌交换等授权类型
+}
+
+// resourceConfig 受保护资源配置，客户端可通过 resource 参数 (RFC 8707) 申请该资源的访问令牌
+type resourceConfig struct {
+	Audience          string   `yaml:"audience"`            // 资源标识，作为访问令牌的 aud
+	AccessTokenFormat string   `yaml:"access_token_format"` // opaque 或 jwt，为空时使用客户端的设置
+	ExchangeClients   []string `yaml:"exchange_clients"`    // 作为该资源服务器的客户端ID，可以通过令牌交换兑换受众为该资源的令牌
+	IntrospectClients []string `yaml:"introspect_clients"`  // 作为该资源服务器的客户端ID，可以自省受众为该资源的访问令牌
+}
+
+type oauthConfig struct {
+	Registration   registrationConfig `yaml:"registration"`
+	Resources      []resourceConfig   `yaml:"resources"`
+	PairwiseSecret string             `yaml:"pairwise_secret"` // 计算 pairwise 主体标识的服务端密钥，为空时不支持 pairwise
+
+	PortalClientCredentials bool `yaml:"portal_client_credentials"` // 是否允许开发者为自己的机密客户端开启 client_credentials
+}
+
+// FindResource 通过资源标识查找受保护资源配置，未登记时返回 nil
+func (o *oauthConfig) FindResource(audience string) *resourceConfig {
+	for i := range o.Resources {
+		if o.Resources[i].Audience == audience {
+			return &o.Resources[i]
+		}
+	}
+	return nil
+}
+
 // Config 结构体定义配置项
 type Config struct {
 	Server    ServerConfig    `yaml:"server"`
 	Database  DatabaseConfig  `yaml:"database"`
 	Turnstile turnstileConfig `yaml:"turnstile"`
 	SMTP      smtpConfig      `yaml:"smtp"`
+	OAuth     oauthConfig     `yaml:"oauth"`
 }
 
 // 全局变量保存配置
@@ -74,6 +110,18 @@ func defaultConfig() *Config {
 			Username: "",
 			Password: "your-email-password",
 		},
+		OAuth: oauthConfig{
+			Registration: registrationConfig{
+				Enabled:              false,
+				InitialAccessTokens:  []string{},
+				AllowAnonymous:       false,
+				AllowedScopes:        []string{"user:info", "user:email"},
+				PrivilegedGrantTypes: []string{},
+			},
+			Resources:               []resourceConfig{},
+			PairwiseSecret:          "",
+			PortalClientCredentials: false,
+		},
 	}
 }
 
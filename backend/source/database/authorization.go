@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"nyauth_backed/source/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// SaveAuthorization 记录用户同意授予应用的权限范围与所选身份，已有授权记录时合并权限范围
+// 用户更换了身份时，此前同意的权限范围针对的是其他身份，不再保留
+func SaveAuthorization(userID, clientID, identityID string, scope []string) error {
+	collection := client.Database(DatabaseName).Collection(AuthorizationCollection)
+
+	_, err := collection.UpdateOne(
+		context.TODO(),
+		bson.M{"user_id": userID, "client_id": clientID, "identity_id": bson.M{"$ne": identityID}},
+		bson.M{"$set": bson.M{"scope": []string{}}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save authorization: %w", err)
+	}
+
+	now := bson.DateTime(time.Now().UnixNano() / int64(time.Millisecond))
+	_, err = collection.UpdateOne(
+		context.TODO(),
+		bson.M{"user_id": userID, "client_id": clientID},
+		bson.M{
+			"$addToSet":    bson.M{"scope": bson.M{"$each": scope}},
+			"$set":         bson.M{"identity_id": identityID, "updated_at": now},
+			"$setOnInsert": bson.M{"_id": bson.NewObjectID(), "created_at": now},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save authorization: %w", err)
+	}
+
+	return nil
+}
+
+// AddAuthorizationScope 向用户对应用的授权记录中合并权限范围，不改变此前授权时选择的身份
+// 用于不经过身份选择的授权方式（如设备授权）
+func AddAuthorizationScope(userID, clientID string, scope []string) error {
+	collection := client.Database(DatabaseName).Collection(AuthorizationCollection)
+
+	now := bson.DateTime(time.Now().UnixNano() / int64(time.Millisecond))
+	_, err := collection.UpdateOne(
+		context.TODO(),
+		bson.M{"user_id": userID, "client_id": clientID},
+		bson.M{
+			"$addToSet":    bson.M{"scope": bson.M{"$each": scope}},
+			"$set":         bson.M{"updated_at": now},
+			"$setOnInsert": bson.M{"_id": bson.NewObjectID(), "identity_id": "", "created_at": now},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save authorization: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuthorization 获取用户对应用的授权记录，不存在时返回 nil
+func GetAuthorization(userID, clientID string) (*models.DatabaseAuthorization, error) {
+	collection := client.Database(DatabaseName).Collection(AuthorizationCollection)
+
+	var authorization models.DatabaseAuthorization
+	err := collection.FindOne(context.TODO(), bson.M{"user_id": userID, "client_id": clientID}).Decode(&authorization)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &authorization, nil
+}
+
+// GetAuthorizationsByUser 获取用户授权过的所有应用记录
+func GetAuthorizationsByUser(userID string) ([]models.DatabaseAuthorization, error) {
+	collection := client.Database(DatabaseName).Collection(AuthorizationCollection)
+
+	// 初始化一个空数组，确保即使没有记录也会返回空数组而不是 null
+	authorizations := []models.DatabaseAuthorization{}
+
+	cursor, err := collection.Find(context.TODO(), bson.M{"user_id": userID})
+	if err != nil {
+		return authorizations, err
+	}
+	defer cursor.Close(context.TODO())
+
+	if err := cursor.All(context.TODO(), &authorizations); err != nil {
+		return authorizations, err
+	}
+
+	return authorizations, nil
+}
+
+// DeleteAuthorization 删除用户对应用的授权记录，返回是否存在该记录
+func DeleteAuthorization(userID, clientID string) (bool, error) {
+	collection := client.Database(DatabaseName).Collection(AuthorizationCollection)
+
+	result, err := collection.DeleteOne(context.TODO(), bson.M{"user_id": userID, "client_id": clientID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete authorization: %w", err)
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteAuthorizationsByClient 删除应用的全部授权记录
+func DeleteAuthorizationsByClient(clientID string) error {
+	collection := client.Database(DatabaseName).Collection(AuthorizationCollection)
+
+	_, err := collection.DeleteMany(context.TODO(), bson.M{"client_id": clientID})
+	if err != nil {
+		return fmt.Errorf("failed to delete authorizations: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"nyauth_backed/source/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CreateClient 创建新的客户端，ID 与时间字段由本函数填写
+func CreateClient(dbClient *models.DatabaseClient) (string, error) {
+	collection := client.Database(DatabaseName).Collection(ClientCollection)
+
+	now := bson.DateTime(time.Now().UnixNano() / int64(time.Millisecond))
+	dbClient.ID = bson.NewObjectID()
+	dbClient.CreatedAt = now
+	dbClient.UpdatedAt = now
+
+	_, err := collection.InsertOne(context.TODO(), dbClient)
+	if err != nil {
+		return "", err
+	}
+
+	return dbClient.ID.Hex(), nil
+}
+
+// GetClientsByCreator 获取用户创建的所有客户端
+func GetClientsByCreator(userID string) ([]models.DatabaseClient, error) {
+	collection := client.Database(DatabaseName).Collection(ClientCollection)
+
+	// 初始化一个空数组，确保即使没有记录也会返回空数组而不是 null
+	clients := []models.DatabaseClient{}
+
+	cursor, err := collection.Find(context.TODO(), bson.M{"createdBy": userID})
+	if err != nil {
+		return clients, err
+	}
+	defer cursor.Close(context.TODO())
+
+	if err := cursor.All(context.TODO(), &clients); err != nil {
+		return clients, err
+	}
+
+	return clients, nil
+}
+
+// UpdateClient 通过ClientID更新客户端信息
+func UpdateClient(clientID string, updates map[string]interface{}) error {
+	collection := client.Database(DatabaseName).Collection(ClientCollection)
+
+	// 将字符串类型的 clientID 转换为 ObjectID
+	objID, err := bson.ObjectIDFromHex(clientID)
+	if err != nil {
+		return fmt.Errorf("invalid client ID: %w", err)
+	}
+
+	// 添加更新时间
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	updates["updated_at"] = bson.DateTime(time.Now().UnixNano() / int64(time.Millisecond))
+
+	_, err = collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": objID},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update client information: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteClient 通过ClientID删除客户端
+func DeleteClient(clientID string) error {
+	collection := client.Database(DatabaseName).Collection(ClientCollection)
+
+	objID, err := bson.ObjectIDFromHex(clientID)
+	if err != nil {
+		return fmt.Errorf("invalid client ID: %w", err)
+	}
+
+	_, err = collection.DeleteOne(context.TODO(), bson.M{"_id": objID})
+	if err != nil {
+		return fmt.Errorf("failed to delete client: %w", err)
+	}
+
+	return nil
+}
+
+// TouchClientSecret 记录客户端密钥最近一次使用的时间
+func TouchClientSecret(clientID string, secretID string) error {
+	collection := client.Database(DatabaseName).Collection(ClientCollection)
+
+	objID, err := bson.ObjectIDFromHex(clientID)
+	if err != nil {
+		return fmt.Errorf("invalid client ID: %w", err)
+	}
+
+	_, err = collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": objID, "client_secrets.secret_id": secretID},
+		bson.M{"$set": bson.M{
+			"client_secrets.$.last_used_at": bson.DateTime(time.Now().UnixNano() / int64(time.Millisecond)),
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update client secret: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnsupportedJWK = errors.New("unsupported json web key")
+
+// JSONWebKey 表示客户端提交的公钥 (RFC 7517)，目前支持 RSA 与 EC 两种类型
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// ParseJWKSet 解析 JWKS 字符串 ({"keys": [...]})
+func ParseJWKSet(raw string) ([]JSONWebKey, error) {
+	var set struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal([]byte(raw), &set); err != nil {
+		return nil, err
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("jwks contains no keys")
+	}
+	for _, key := range set.Keys {
+		if _, err := key.PublicKey(); err != nil {
+			return nil, err
+		}
+	}
+	return set.Keys, nil
+}
+
+// PublicKey 将 JWK 转换为 Go 的公钥类型
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedJWK
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedJWK
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrUnsupportedJWK
+		}
+		return pub, nil
+	default:
+		return nil, ErrUnsupportedJWK
+	}
+}
+
+// Thumbprint 计算 JWK 的 SHA-256 指纹 (RFC 7638)，只使用各类型必需的成员并按字典序排列
+func (k JSONWebKey) Thumbprint() (string, error) {
+	var members string
+	switch k.Kty {
+	case "RSA":
+		members = `{"e":` + jsonString(k.E) + `,"kty":"RSA","n":` + jsonString(k.N) + `}`
+	case "EC":
+		members = `{"crv":` + jsonString(k.Crv) + `,"kty":"EC","x":` + jsonString(k.X) + `,"y":` + jsonString(k.Y) + `}`
+	default:
+		return "", ErrUnsupportedJWK
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// jsonString 将字符串编码为 JSON 字符串字面量
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// FindJWK 按 kid 查找公钥，kid 为空且只有一把公钥时直接返回该公钥
+func FindJWK(keys []JSONWebKey, kid string) (crypto.PublicKey, error) {
+	if kid == "" && len(keys) == 1 {
+		return keys[0].PublicKey()
+	}
+	for _, key := range keys {
+		if key.Kid == kid {
+			return key.PublicKey()
+		}
+	}
+	return nil, errors.New("no matching key found in jwks")
+}
+
+// 客户端签名 JWT 允许使用的算法
+var ClientSigningAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// ParseJWTWithJWKS 使用客户端注册的 JWKS 验证 JWT 签名并返回其声明
+func ParseJWTWithJWKS(tokenString string, keys []JSONWebKey, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	opts = append(opts, jwt.WithValidMethods(ClientSigningAlgs))
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return FindJWK(keys, kid)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("unexpected claims type")
+	}
+	return claims, nil
+}
@@ -0,0 +1,64 @@
+package helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+// RFC 7638 §3.1 中的示例公钥
+var rfcThumbprintKey = JSONWebKey{
+	Kty: "RSA",
+	N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	E:   "AQAB",
+}
+
+func TestThumbprint(t *testing.T) {
+	got, err := rfcThumbprintKey.Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint() error = %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Thumbprint() = %q, want %q", got, want)
+	}
+
+	// kid、alg 等可选成员不参与计算
+	withOptional := rfcThumbprintKey
+	withOptional.Kid = "2011-04-29"
+	withOptional.Alg = "RS256"
+	if again, _ := withOptional.Thumbprint(); again != got {
+		t.Errorf("Thumbprint() with optional members = %q, want %q", again, got)
+	}
+
+	if _, err := (JSONWebKey{Kty: "oct"}).Thumbprint(); err != ErrUnsupportedJWK {
+		t.Errorf("Thumbprint() for oct key error = %v, want %v", err, ErrUnsupportedJWK)
+	}
+}
+
+func TestECPublicKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	key := JSONWebKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(privateKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(privateKey.Y.FillBytes(make([]byte, 32))),
+	}
+
+	pub, err := key.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	ecKey, ok := pub.(*ecdsa.PublicKey)
+	if !ok || !ecKey.Equal(&privateKey.PublicKey) {
+		t.Errorf("PublicKey() = %v, want the generated public key", pub)
+	}
+
+	if _, err := key.Thumbprint(); err != nil {
+		t.Errorf("Thumbprint() error = %v", err)
+	}
+}
@@ -94,12 +94,18 @@ func (j *JwtHelperCert) loadKeys() error {
 	return nil
 }
 
+// SigningKeyID JWKS 中签名公钥的 kid
+const SigningKeyID = "Nyauth-Server"
+
+// portalIssuer 门户 JWT 的签发者，与 OAuth 令牌使用的 BaseURL 不同
+const portalIssuer = "Nyauth-Server"
+
 // 签发 JWT
 func (j *JwtHelperCert) IssueToken(payload map[string]interface{}, audience string, expiresInSeconds int64) (string, error) {
 	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
 		"aud":  audience,
-		"iss":  "Nyauth-Server",
+		"iss":  portalIssuer,
 		"iat":  now.Unix(),
 		"exp":  now.Add(time.Duration(expiresInSeconds) * time.Second).Unix(),
 		"data": payload,
@@ -108,21 +114,41 @@ func (j *JwtHelperCert) IssueToken(payload map[string]interface{}, audience stri
 }
 
 // 验证 JWT
+// 访问令牌、ID 令牌与登出令牌同样由该密钥签名，且访问令牌的 aud 可以由 resource 指定，需通过 iss 与 typ 区分
 func (j *JwtHelperCert) VerifyToken(tokenString string, audience string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
 		return j.publicKey, nil
-	}, jwt.WithAudience(audience), jwt.WithIssuedAt(), jwt.WithExpirationRequired())
+	}, jwt.WithAudience(audience), jwt.WithIssuer(portalIssuer), jwt.WithIssuedAt(), jwt.WithExpirationRequired())
 
 	if err != nil {
 		return nil, err
 	}
 
+	if typ, _ := token.Header["typ"].(string); typ != "JWT" {
+		return nil, errors.New("unexpected token type: " + typ)
+	}
+
 	return token, nil
 }
 
+// IssueAccessToken 签发 JWT 格式的访问令牌 (RFC 9068)
+// claims 由调用方填写，iss 固定为本服务的签发者
+func (j *JwtHelperCert) IssueAccessToken(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = source.AppConfig.Server.BaseURL
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+
+	// RFC 9068 §2.1 要求使用 at+jwt 类型，避免与 ID 令牌混用
+	token.Header["typ"] = "at+jwt"
+	// 资源服务器按 kid 从 JWKS 中选择验证公钥
+	token.Header["kid"] = SigningKeyID
+
+	return token.SignedString(j.privateKey)
+}
+
 // 生成 RSA 公钥和私钥对
 func generateKeys() (*rsa.PrivateKey, *rsa.PublicKey, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -191,6 +217,9 @@ func (j *JwtHelperCert) IssueOIDCToken(
 	subject string, // 用户唯一标识
 	audience string, // 客户端ID
 	nonce string, // 防止重放攻击的随机字符串(可选)
+	sessionID string, // 登录会话ID(可选)，用于登出通知
+	authTime time.Time, // 用户实际登录的时间
+	userClaims map[string]interface{}, // 按权限范围附加的用户资料声明(可选)
 	expiresInSeconds int64, // 过期时间（秒）
 ) (string, error) {
 	now := time.Now()
@@ -199,11 +228,11 @@ func (j *JwtHelperCert) IssueOIDCToken(
 	// 创建标准 OIDC 声明
 	claims := jwt.MapClaims{
 		"iss":       source.AppConfig.Server.BaseURL,
-		"sub":       subject,    // 用户唯一标识
-		"aud":       audience,   // 客户端ID
-		"iat":       now.Unix(), // 签发时间
-		"exp":       exp.Unix(), // 过期时间
-		"auth_time": now.Unix(), // 认证时间，默认使用当前时间
+		"sub":       subject,         // 用户唯一标识
+		"aud":       audience,        // 客户端ID
+		"iat":       now.Unix(),      // 签发时间
+		"exp":       exp.Unix(),      // 过期时间
+		"auth_time": authTime.Unix(), // 认证时间
 	}
 
 	// 添加可选的nonce声明
@@ -211,6 +240,17 @@ func (j *JwtHelperCert) IssueOIDCToken(
 		claims["nonce"] = nonce
 	}
 
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+
+	// 附加声明不能覆盖上面的标准声明
+	for key, value := range userClaims {
+		if _, exists := claims[key]; !exists {
+			claims[key] = value
+		}
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
 
 	// 设置JWT头部
@@ -219,6 +259,61 @@ func (j *JwtHelperCert) IssueOIDCToken(
 	return token.SignedString(j.privateKey)
 }
 
+// IssueLogoutToken 生成 OIDC Back-Channel Logout 令牌
+func (j *JwtHelperCert) IssueLogoutToken(
+	subject string, // 签发给该客户端的 sub
+	audience string, // 客户端ID
+	sessionID string, // 登录会话ID
+	jti string, // 令牌唯一标识
+) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss": source.AppConfig.Server.BaseURL,
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(2 * time.Minute).Unix(),
+		"jti": jti,
+		"sid": sessionID,
+		// 登出令牌必须包含该事件，且不能包含 nonce
+		"events": map[string]interface{}{
+			"http://schemas.openid.net/event/backchannel-logout": map[string]interface{}{},
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = "logout+jwt"
+
+	return token.SignedString(j.privateKey)
+}
+
+// ParseIDToken 验证本服务签发的 ID 令牌并返回其声明，允许已过期的令牌 (用于 id_token_hint)
+func (j *JwtHelperCert) ParseIDToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return j.publicKey, nil
+	}, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	// 门户 JWT 与访问令牌同样由该密钥签名，需通过 typ 与 iss 区分
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("unexpected claims type")
+	}
+	if typ, _ := token.Header["typ"].(string); typ != "JWT" {
+		return nil, errors.New("not an id token")
+	}
+	if iss, _ := claims["iss"].(string); iss != source.AppConfig.Server.BaseURL {
+		return nil, errors.New("not an id token")
+	}
+	return claims, nil
+}
+
 // GetPublicKey 返回用于验证的公钥
 func (j *JwtHelperCert) GetPublicKey() *rsa.PublicKey {
 	return j.publicKey
@@ -20,19 +20,55 @@ type DatabaseUser struct {
 	RecoveryCodes []string      `bson:"recovery_codes"`
 }
 
+// 客户端状态
+const (
+	ClientStatusActive   = 0 // 正常
+	ClientStatusDisabled = 1 // 已被创建者停用
+)
+
 // client 集合中的文档结构
 type DatabaseClient struct {
-	ID           bson.ObjectID `bson:"_id"`
-	ClientName   string        `bson:"client_name"`
-	Description  string        `bson:"description"`
-	Avatar       string        `bson:"avatar"`
-	ClientSecret string        `bson:"client_secret"`
-	RedirectURI  string        `bson:"redirect_uri"`
-	Permissions  []string      `bson:"permissions"`
-	Status       int           `bson:"status"`
-	CreatedBy    string        `bson:"createdBy"`
-	CreatedAt    bson.DateTime `bson:"created_at"`
-	UpdatedAt    bson.DateTime `bson:"updated_at"`
+	ID                      bson.ObjectID          `bson:"_id"`
+	ClientName              string                 `bson:"client_name"`
+	Description             string                 `bson:"description"`
+	Avatar                  string                 `bson:"avatar"`
+	ClientSecret            string                 `bson:"client_secret"`              // 旧版明文密钥，首次验证通过后迁移到 ClientSecrets
+	ClientSecretHash        string                 `bson:"client_secret_hash"`         // 旧版单个密钥的 SHA256 值，首次验证通过后迁移到 ClientSecrets
+	ClientSecrets           []DatabaseClientSecret `bson:"client_secrets"`             // 当前持有的密钥，轮换期间新旧密钥同时有效
+	TokenEndpointAuthMethod string                 `bson:"token_endpoint_auth_method"` // 为空时机密客户端可使用 client_secret_basic 或 client_secret_post
+	JWKS                    string                 `bson:"jwks"`                       // 客户端公钥集 (JSON)，用于验证 private_key_jwt 断言与请求对象
+	RedirectURI             string                 `bson:"redirect_uri"`               // 旧版单个重定向URI，保留以兼容已有数据
+	RedirectURIs            []string               `bson:"redirect_uris"`              // 已注册的重定向URI列表
+	Permissions             []string               `bson:"permissions"`
+	PublicClient            bool                   `bson:"public_client"`             // 公开客户端（SPA/移动端），不持有密钥，必须使用 PKCE
+	GrantTypes              []string               `bson:"grant_types"`               // 允许使用的授权类型，为空时仅允许 authorization_code 与 refresh_token
+	Status                  int                    `bson:"status"`                    // 见 ClientStatusActive 等常量
+	RegistrationAccessToken string                 `bson:"registration_access_token"` // 动态注册颁发的管理令牌的 SHA256 值
+	CreatedBy               string                 `bson:"createdBy"`
+	CreatedAt               bson.DateTime          `bson:"created_at"`
+	UpdatedAt               bson.DateTime          `bson:"updated_at"`
+
+	RequirePushedAuthorizationRequests bool   `bson:"require_pushed_authorization_requests"` // 授权请求必须先通过 PAR 端点提交
+	RequireSignedRequestObject         bool   `bson:"require_signed_request_object"`         // 授权请求必须使用以 JWKS 签名的请求对象
+	AccessTokenFormat                  string `bson:"access_token_format"`                   // 访问令牌格式 (opaque/jwt)，为空时为 opaque
+
+	SubjectType         string `bson:"subject_type"`          // 主体标识类型 (public/pairwise)，为空时为 public
+	SectorIdentifierURI string `bson:"sector_identifier_uri"` // pairwise 主体的扇区标识地址，为空时按客户端计算
+
+	PostLogoutRedirectURIs            []string `bson:"post_logout_redirect_uris"`            // 登出后允许跳转的地址
+	FrontchannelLogoutURI             string   `bson:"frontchannel_logout_uri"`              // 用户登出时由浏览器加载的地址
+	FrontchannelLogoutSessionRequired bool     `bson:"frontchannel_logout_session_required"` // 前端登出地址是否需要附带 iss 与 sid
+	BackchannelLogoutURI              string   `bson:"backchannel_logout_uri"`               // 用户登出时接收登出令牌的地址
+	BackchannelLogoutSessionRequired  bool     `bson:"backchannel_logout_session_required"`  // 登出令牌是否必须包含 sid
+}
+
+// 客户端密钥，内嵌在 client 文档中
+type DatabaseClientSecret struct {
+	SecretID   string        `bson:"secret_id"`
+	SecretHash string        `bson:"secret_hash"` // 密钥的 SHA256 值
+	CreatedAt  bson.DateTime `bson:"created_at"`
+	ExpiresAt  bson.DateTime `bson:"expires_at"`   // 为 0 时永不过期
+	LastUsedAt bson.DateTime `bson:"last_used_at"` // 最近一次认证成功的时间
 }
 
 // identity 集合中的文档结构 (用户的多身份)
@@ -47,3 +83,14 @@ type DatabaseUserIdentity struct {
 	CreatedAt   bson.DateTime `bson:"created_at"`
 	UpdatedAt   bson.DateTime `bson:"updated_at"`
 }
+
+// authorization 集合中的文档结构 (用户对应用的授权记录)
+type DatabaseAuthorization struct {
+	ID         bson.ObjectID `bson:"_id"`
+	UserID     string        `bson:"user_id"`
+	ClientID   string        `bson:"client_id"`
+	IdentityID string        `bson:"identity_id"` // 用户授权时选择的多身份ID，为空时代表用户本身
+	Scope      []string      `bson:"scope"`       // 用户已同意的权限范围
+	CreatedAt  bson.DateTime `bson:"created_at"`
+	UpdatedAt  bson.DateTime `bson:"updated_at"`
+}
@@ -1,5 +1,86 @@
 package models
 
+import "encoding/json"
+
 type GetClientinfoCredentials struct {
-	ClientID string `json:"client_id"`
+	ClientID   string `json:"client_id"`
+	Scope      string `json:"scope"`       // 可选，提供时返回用户此前的授权是否已覆盖这些权限范围
+	RequestURI string `json:"request_uri"` // 可选，使用 PAR 时从推送的请求中读取授权参数
+
+	// 可选，用于判断是否需要重新登录或再次确认授权
+	Prompt      string `json:"prompt"`
+	MaxAge      string `json:"max_age"`
+	LoginHint   string `json:"login_hint"`
+	IDTokenHint string `json:"id_token_hint"`
+	LoginState  string `json:"login_state"` // 重新登录后带回的 login_state
+	IdentityID  string `json:"identity_id"` // 用户选择的身份，与此前授权时的身份不同时需要再次确认
+}
+
+// ClientRegistrationRequest 动态客户端注册请求 (RFC 7591)
+type ClientRegistrationRequest struct {
+	RedirectURIs            []string        `json:"redirect_uris"`
+	ClientName              string          `json:"client_name"`
+	LogoURI                 string          `json:"logo_uri"`
+	GrantTypes              []string        `json:"grant_types"`
+	TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method"`
+	JWKS                    json.RawMessage `json:"jwks"`
+	Scope                   string          `json:"scope"`
+
+	RequirePushedAuthorizationRequests bool   `json:"require_pushed_authorization_requests"`
+	RequireSignedRequestObject         bool   `json:"require_signed_request_object"`
+	AccessTokenFormat                  string `json:"access_token_format"`
+
+	SubjectType         string `json:"subject_type"`
+	SectorIdentifierURI string `json:"sector_identifier_uri"`
+
+	PostLogoutRedirectURIs            []string `json:"post_logout_redirect_uris"`
+	FrontchannelLogoutURI             string   `json:"frontchannel_logout_uri"`
+	FrontchannelLogoutSessionRequired bool     `json:"frontchannel_logout_session_required"`
+	BackchannelLogoutURI              string   `json:"backchannel_logout_uri"`
+	BackchannelLogoutSessionRequired  bool     `json:"backchannel_logout_session_required"`
+}
+
+// ClientCredentials 开发者创建或更新应用的参数
+type ClientCredentials struct {
+	ClientName   string   `json:"client_name" binding:"required"`
+	Description  string   `json:"description"`
+	Avatar       string   `json:"avatar"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Permissions  []string `json:"permissions"`
+	GrantTypes   []string `json:"grant_types"`   // 为空时仅允许 authorization_code 与 refresh_token
+	PublicClient bool     `json:"public_client"` // 仅在创建时生效
+
+	TokenEndpointAuthMethod            string          `json:"token_endpoint_auth_method"`            // 机密客户端的认证方式，为空时可使用 client_secret_basic 或 client_secret_post
+	JWKS                               json.RawMessage `json:"jwks"`                                  // 用于验证请求对象的公钥集
+	RequirePushedAuthorizationRequests bool            `json:"require_pushed_authorization_requests"` // 是否要求通过 PAR 提交授权请求
+	RequireSignedRequestObject         bool            `json:"require_signed_request_object"`         // 是否要求使用签名的请求对象
+	AccessTokenFormat                  string          `json:"access_token_format"`                   // 访问令牌格式 (opaque/jwt)，为空时为 opaque
+
+	SubjectType         string `json:"subject_type"`          // 主体标识类型 (public/pairwise)，为空时为 public
+	SectorIdentifierURI string `json:"sector_identifier_uri"` // pairwise 主体的扇区标识地址，为空时按应用计算
+
+	PostLogoutRedirectURIs            []string `json:"post_logout_redirect_uris"`            // 登出后允许跳转的地址
+	FrontchannelLogoutURI             string   `json:"frontchannel_logout_uri"`              // 前端登出地址
+	FrontchannelLogoutSessionRequired bool     `json:"frontchannel_logout_session_required"` // 前端登出地址是否需要附带 iss 与 sid
+	BackchannelLogoutURI              string   `json:"backchannel_logout_uri"`               // 后端登出地址
+	BackchannelLogoutSessionRequired  bool     `json:"backchannel_logout_session_required"`  // 登出令牌是否必须包含 sid
+}
+
+// EndSessionRequest 用户确认登出的参数 (OIDC RP-Initiated Logout)
+type EndSessionRequest struct {
+	IDTokenHint           string `json:"id_token_hint"`
+	ClientID              string `json:"client_id"`
+	PostLogoutRedirectURI string `json:"post_logout_redirect_uri"`
+	State                 string `json:"state"`
+}
+
+// DeviceVerificationRequest 用户确认设备授权的参数
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"` // 为 false 时拒绝授权
+}
+
+// ClientSecretRotation 轮换应用密钥的参数
+type ClientSecretRotation struct {
+	GracePeriod *int `json:"grace_period"` // 旧密钥继续有效的秒数，不填时使用默认值，为 0 时立即失效
 }
@@ -1,17 +1,32 @@
 package oauth
 
 import (
+	"errors"
 	"nyauth_backed/source/untils"
 	"sync"
 	"time"
 )
 
+var (
+	ErrAuthorizationCodeInvalid = errors.New("authorization code is invalid or expired")
+	ErrAuthorizationCodeReused  = errors.New("authorization code has already been used")
+)
+
 // AuthorizationCode 结构体用于存储授权码信息
 type AuthorizationCode struct {
-	Code     string    // 授权码
-	ClientID string    // 客户端ID
-	UserID   string    // 用户ID
-	Exp      time.Time // 过期时间
+	Code                string    // 授权码
+	ClientID            string    // 客户端ID
+	UserID              string    // 用户ID
+	IdentityID          string    // 用户授权时选择的多身份ID，为空时代表用户本身
+	RedirectURI         string    // 授权时使用的重定向URI
+	Scope               []string  // 授权时请求的权限范围，签发令牌时再与应用权限取交集
+	CodeChallenge       string    // PKCE code_challenge
+	CodeChallengeMethod string    // PKCE code_challenge_method
+	FamilyID            string    // 由该授权码签发的令牌所属的令牌族ID
+	SessionID           string    // 授权时用户的登录会话ID
+	AuthTime            time.Time // 用户实际登录的时间
+	Used                bool      // 是否已被兑换
+	Exp                 time.Time // 过期时间
 }
 
 var (
@@ -21,7 +36,8 @@ var (
 )
 
 // CreateAuthorizationCode 创建新的授权码并存储在内存中
-func CreateAuthorizationCode(clientID, userID string, expiresIn ...int) (string, error) {
+// authCode 中的 Code、FamilyID 与 Exp 由本函数生成，其余字段由调用方填写
+func CreateAuthorizationCode(authCode AuthorizationCode, expiresIn ...int) (string, error) {
 	code, err := untils.GenerateRandomCode(32, false) // 生成随机字符串作为授权码
 	if err != nil {
 		return "", err
@@ -33,17 +49,19 @@ func CreateAuthorizationCode(clientID, userID string, expiresIn ...int) (string,
 		exp = expiresIn[0]
 	}
 
-	// 创建授权码对象
-	authCode := &AuthorizationCode{
-		Code:     code,
-		ClientID: clientID,
-		UserID:   userID,
-		Exp:      time.Now().Add(time.Duration(exp) * time.Second),
+	familyID, err := NewFamilyID()
+	if err != nil {
+		return "", err
 	}
 
+	// 补全授权码对象
+	authCode.Code = code
+	authCode.FamilyID = familyID
+	authCode.Exp = time.Now().Add(time.Duration(exp) * time.Second)
+
 	// 存储到内存中
 	authCodeMutex.Lock()
-	authCodes[code] = authCode
+	authCodes[code] = &authCode
 	authCodeMutex.Unlock()
 
 	return code, nil
@@ -55,14 +73,44 @@ func GetAuthorizationCode(code string) (*AuthorizationCode, bool) {
 	defer authCodeMutex.RUnlock()
 
 	authCode, exists := authCodes[code]
-	if !exists || time.Now().After(authCode.Exp) {
-		// 如果不存在或已过期
+	if !exists || authCode.Used || time.Now().After(authCode.Exp) {
+		// 如果不存在、已兑换或已过期
 		return nil, false
 	}
 
 	return authCode, true
 }
 
+// ConsumeAuthorizationCode 兑换授权码，授权码只能被签发给它的客户端以相同的 redirect_uri 兑换一次
+// 已兑换的授权码再次出现时视为泄露，由它签发的所有令牌都会被吊销 (RFC 6749 §4.1.2)
+func ConsumeAuthorizationCode(code, clientID, redirectURI string) (*AuthorizationCode, error) {
+	authCodeMutex.Lock()
+
+	authCode, exists := authCodes[code]
+	if !exists || time.Now().After(authCode.Exp) {
+		authCodeMutex.Unlock()
+		return nil, ErrAuthorizationCodeInvalid
+	}
+
+	// 绑定关系不符时不消耗授权码，避免被他人恶意作废
+	if authCode.ClientID != clientID || authCode.RedirectURI != redirectURI {
+		authCodeMutex.Unlock()
+		return nil, ErrAuthorizationCodeInvalid
+	}
+
+	if authCode.Used {
+		authCodeMutex.Unlock()
+		RevokeTokenFamily(authCode.FamilyID)
+		return nil, ErrAuthorizationCodeReused
+	}
+
+	// 已兑换的授权码保留到过期，用于检测重放
+	authCode.Used = true
+	authCodeMutex.Unlock()
+
+	return authCode, nil
+}
+
 // RemoveAuthorizationCode 移除授权码
 func RemoveAuthorizationCode(code string) {
 	authCodeMutex.Lock()
@@ -70,6 +118,18 @@ func RemoveAuthorizationCode(code string) {
 	delete(authCodes, code)
 }
 
+// RemoveAuthorizationCodesByClient 移除客户端尚未兑换的授权码，userID 为空时移除该客户端的全部授权码
+func RemoveAuthorizationCodesByClient(clientID, userID string) {
+	authCodeMutex.Lock()
+	defer authCodeMutex.Unlock()
+
+	for code, authCode := range authCodes {
+		if authCode.ClientID == clientID && (userID == "" || authCode.UserID == userID) && !authCode.Used {
+			delete(authCodes, code)
+		}
+	}
+}
+
 // 定期清理过期的授权码
 func init() {
 	go periodicCleanup(cleanupExpiredCodes, 5*time.Minute)
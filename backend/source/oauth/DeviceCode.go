@@ -0,0 +1,241 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"nyauth_backed/source/untils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RFC 8628 设备授权类型
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+var (
+	ErrDeviceCodeInvalid    = errors.New("device code is invalid")
+	ErrDeviceCodeExpired    = errors.New("device code has expired")
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("polling too frequently")
+	ErrDeviceAccessDenied   = errors.New("user denied the device authorization")
+)
+
+// 设备授权状态
+const (
+	DeviceStatusPending  = 0 // 等待用户确认
+	DeviceStatusApproved = 1 // 用户已同意
+	DeviceStatusDenied   = 2 // 用户已拒绝
+)
+
+// 用户码字符集，去掉元音与容易混淆的字符 (RFC 8628 §6.1)
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// 默认轮询间隔，客户端轮询过快时每次增加 5 秒
+const defaultDeviceInterval = 5
+
+// DeviceAuthorization 结构体用于存储设备授权信息
+type DeviceAuthorization struct {
+	DeviceCode   string    // 设备码，由设备用于轮询令牌端点
+	UserCode     string    // 用户码，由用户在浏览器中输入，不含分隔符
+	ClientID     string    // 客户端ID
+	Scope        []string  // 请求的权限范围
+	UserID       string    // 确认授权的用户ID
+	SessionID    string    // 确认授权时用户的登录会话ID
+	AuthTime     time.Time // 用户实际登录的时间
+	Status       int       // 见 DeviceStatusPending 等常量
+	Interval     int       // 最小轮询间隔（秒）
+	LastPolledAt time.Time // 上一次轮询时间
+	Exp          time.Time // 过期时间
+}
+
+var (
+	// 内存存储设备授权，分别以设备码与用户码索引
+	deviceAuthorizations = make(map[string]*DeviceAuthorization)
+	deviceUserCodes      = make(map[string]*DeviceAuthorization)
+	deviceMutex          sync.Mutex
+)
+
+// CreateDeviceAuthorization 创建新的设备授权并存储在内存中
+// da 中的 DeviceCode、UserCode、Status、Interval 与 Exp 由本函数生成，其余字段由调用方填写
+func CreateDeviceAuthorization(da DeviceAuthorization, expiresIn ...int) (DeviceAuthorization, error) {
+	// 默认过期时间为10分钟
+	exp := 600
+	if len(expiresIn) > 0 && expiresIn[0] > 0 {
+		exp = expiresIn[0]
+	}
+
+	deviceCode, err := untils.GenerateRandomCode(48, false)
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+
+	// 用户码较短，生成后需确认没有与进行中的授权冲突
+	var userCode string
+	for {
+		userCode, err = generateUserCode(8)
+		if err != nil {
+			return DeviceAuthorization{}, err
+		}
+		if _, exists := deviceUserCodes[userCode]; !exists {
+			break
+		}
+	}
+
+	da.DeviceCode = deviceCode
+	da.UserCode = userCode
+	da.Status = DeviceStatusPending
+	da.Interval = defaultDeviceInterval
+	da.Exp = time.Now().Add(time.Duration(exp) * time.Second)
+
+	deviceAuthorizations[deviceCode] = &da
+	deviceUserCodes[userCode] = &da
+
+	return da, nil
+}
+
+// GetDeviceAuthorizationByUserCode 通过用户码获取等待确认的设备授权
+func GetDeviceAuthorizationByUserCode(userCode string) (DeviceAuthorization, bool) {
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+
+	da, exists := deviceUserCodes[NormalizeUserCode(userCode)]
+	if !exists || da.Status != DeviceStatusPending || time.Now().After(da.Exp) {
+		return DeviceAuthorization{}, false
+	}
+
+	return *da, true
+}
+
+// CompleteDeviceAuthorization 用户确认或拒绝设备授权，每个用户码只能确认一次
+func CompleteDeviceAuthorization(userCode, userID, sessionID string, authTime time.Time, approved bool) error {
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+
+	da, exists := deviceUserCodes[NormalizeUserCode(userCode)]
+	if !exists || da.Status != DeviceStatusPending || time.Now().After(da.Exp) {
+		return ErrDeviceCodeInvalid
+	}
+
+	if approved {
+		da.Status = DeviceStatusApproved
+		da.UserID = userID
+		da.SessionID = sessionID
+		da.AuthTime = authTime
+	} else {
+		da.Status = DeviceStatusDenied
+	}
+
+	// 用户码使用后即失效，设备码保留到被兑换或过期
+	delete(deviceUserCodes, da.UserCode)
+
+	return nil
+}
+
+// PollDeviceAuthorization 设备轮询授权结果 (RFC 8628 §3.5)
+// 用户已同意时返回授权信息并使设备码失效，否则返回对应的错误
+func PollDeviceAuthorization(deviceCode, clientID string) (DeviceAuthorization, error) {
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+
+	da, exists := deviceAuthorizations[deviceCode]
+	if !exists || da.ClientID != clientID {
+		return DeviceAuthorization{}, ErrDeviceCodeInvalid
+	}
+
+	now := time.Now()
+	if now.After(da.Exp) {
+		removeDeviceAuthorizationLocked(da)
+		return DeviceAuthorization{}, ErrDeviceCodeExpired
+	}
+
+	switch da.Status {
+	case DeviceStatusApproved:
+		removeDeviceAuthorizationLocked(da)
+		return *da, nil
+	case DeviceStatusDenied:
+		removeDeviceAuthorizationLocked(da)
+		return DeviceAuthorization{}, ErrDeviceAccessDenied
+	}
+
+	// 轮询间隔过短时要求设备放慢速度
+	tooFast := !da.LastPolledAt.IsZero() && now.Sub(da.LastPolledAt) < time.Duration(da.Interval)*time.Second
+	da.LastPolledAt = now
+	if tooFast {
+		da.Interval += 5
+		return DeviceAuthorization{}, ErrSlowDown
+	}
+
+	return DeviceAuthorization{}, ErrAuthorizationPending
+}
+
+// NormalizeUserCode 规范化用户输入的用户码，忽略大小写、空格与分隔符
+func NormalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	userCode = strings.ReplaceAll(userCode, "-", "")
+	return strings.ReplaceAll(userCode, " ", "")
+}
+
+// FormatUserCode 将用户码格式化为 XXXX-XXXX 的形式，方便用户阅读
+func FormatUserCode(userCode string) string {
+	if len(userCode) <= 4 {
+		return userCode
+	}
+	return userCode[:4] + "-" + userCode[4:]
+}
+
+// generateUserCode 生成指定长度的用户码
+func generateUserCode(length int) (string, error) {
+	charsetLength := big.NewInt(int64(len(userCodeCharset)))
+	result := make([]byte, length)
+	for i := range result {
+		randomIndex, err := rand.Int(rand.Reader, charsetLength)
+		if err != nil {
+			return "", err
+		}
+		result[i] = userCodeCharset[randomIndex.Int64()]
+	}
+	return string(result), nil
+}
+
+// RemoveDeviceAuthorizationsByClient 移除客户端的设备授权，userID 为空时移除该客户端的全部设备授权
+// 指定用户时移除该用户已同意但设备尚未兑换的授权
+func RemoveDeviceAuthorizationsByClient(clientID, userID string) {
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+
+	for _, da := range deviceAuthorizations {
+		if da.ClientID == clientID && (userID == "" || da.UserID == userID) {
+			removeDeviceAuthorizationLocked(da)
+		}
+	}
+}
+
+// removeDeviceAuthorizationLocked 在持有锁的情况下移除设备授权
+func removeDeviceAuthorizationLocked(da *DeviceAuthorization) {
+	delete(deviceAuthorizations, da.DeviceCode)
+	if deviceUserCodes[da.UserCode] == da {
+		delete(deviceUserCodes, da.UserCode)
+	}
+}
+
+// 定期清理过期的设备授权
+func init() {
+	go periodicCleanup(cleanupExpiredDeviceAuthorizations, 5*time.Minute)
+}
+
+// cleanupExpiredDeviceAuthorizations 清理过期的设备授权
+func cleanupExpiredDeviceAuthorizations() {
+	now := time.Now()
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+
+	for _, da := range deviceAuthorizations {
+		if now.After(da.Exp) {
+			removeDeviceAuthorizationLocked(da)
+		}
+	}
+}
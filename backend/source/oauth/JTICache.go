@@ -0,0 +1,53 @@
+package oauth
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// 已使用过的 JWT jti，用于防止断言被重放
+	usedJTIs     = make(map[string]time.Time)
+	usedJTIMutex sync.Mutex
+)
+
+// MarkJTIUsed 记录 jti 直到其所属 JWT 过期，若已使用过则返回 false
+// key 需带上命名空间（如客户端ID），避免不同来源的 jti 相互冲突
+func MarkJTIUsed(key string, exp time.Time) bool {
+	usedJTIMutex.Lock()
+	defer usedJTIMutex.Unlock()
+
+	if until, exists := usedJTIs[key]; exists && time.Now().Before(until) {
+		return false
+	}
+
+	usedJTIs[key] = exp
+	return true
+}
+
+// IsJTIUsed 检查 jti 是否已被使用，不会记录该 jti
+func IsJTIUsed(key string) bool {
+	usedJTIMutex.Lock()
+	defer usedJTIMutex.Unlock()
+
+	until, exists := usedJTIs[key]
+	return exists && time.Now().Before(until)
+}
+
+// 定期清理过期的 jti
+func init() {
+	go periodicCleanup(cleanupExpiredJTIs, 5*time.Minute)
+}
+
+// cleanupExpiredJTIs 清理过期的 jti 记录
+func cleanupExpiredJTIs() {
+	now := time.Now()
+	usedJTIMutex.Lock()
+	defer usedJTIMutex.Unlock()
+
+	for key, exp := range usedJTIs {
+		if now.After(exp) {
+			delete(usedJTIs, key)
+		}
+	}
+}
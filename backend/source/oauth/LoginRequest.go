@@ -0,0 +1,79 @@
+package oauth
+
+import (
+	"nyauth_backed/source/untils"
+	"sync"
+	"time"
+)
+
+// LoginRequest 结构体记录授权请求要求用户重新登录的时间
+// 用户在此之后完成登录，才满足 prompt=login 与 max_age 的要求
+type LoginRequest struct {
+	ClientID    string    // 发起授权请求的客户端ID
+	RequestedAt time.Time // 要求重新登录的时间
+	Exp         time.Time // 过期时间
+}
+
+var (
+	// 内存存储要求重新登录的授权请求
+	loginRequests     = make(map[string]*LoginRequest)
+	loginRequestMutex sync.RWMutex
+)
+
+// CreateLoginRequest 记录要求重新登录的时间，返回前端在登录后随授权请求带回的 login_state
+func CreateLoginRequest(clientID string) (string, error) {
+	state, err := untils.GenerateRandomCode(32, false)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	loginRequestMutex.Lock()
+	loginRequests[state] = &LoginRequest{
+		ClientID:    clientID,
+		RequestedAt: now,
+		// 需留出用户登录的时间
+		Exp: now.Add(10 * time.Minute),
+	}
+	loginRequestMutex.Unlock()
+
+	return state, nil
+}
+
+// GetLoginRequest 返回要求重新登录的时间，不会使其失效
+func GetLoginRequest(state, clientID string) (time.Time, bool) {
+	loginRequestMutex.RLock()
+	defer loginRequestMutex.RUnlock()
+
+	request, exists := loginRequests[state]
+	if !exists || request.ClientID != clientID || time.Now().After(request.Exp) {
+		return time.Time{}, false
+	}
+
+	return request.RequestedAt, true
+}
+
+// DeleteLoginRequest 授权完成后删除记录，login_state 只能用于一次授权
+func DeleteLoginRequest(state string) {
+	loginRequestMutex.Lock()
+	delete(loginRequests, state)
+	loginRequestMutex.Unlock()
+}
+
+// 定期清理过期的记录
+func init() {
+	go periodicCleanup(cleanupExpiredLoginRequests, 5*time.Minute)
+}
+
+// cleanupExpiredLoginRequests 清理过期的重新登录记录
+func cleanupExpiredLoginRequests() {
+	now := time.Now()
+	loginRequestMutex.Lock()
+	defer loginRequestMutex.Unlock()
+
+	for state, request := range loginRequests {
+		if now.After(request.Exp) {
+			delete(loginRequests, state)
+		}
+	}
+}
@@ -1,19 +1,40 @@
 package oauth
 
 import (
+	"nyauth_backed/source/helper"
 	"nyauth_backed/source/untils"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 访问令牌格式
+const (
+	TokenFormatOpaque = "opaque" // 随机字符串，只能通过自省端点验证
+	TokenFormatJWT    = "jwt"    // RS256 签名的 JWT (RFC 9068)，资源服务器可离线验证
 )
 
+// DefaultTokenExpiresIn 访问令牌默认有效期（秒）
+const DefaultTokenExpiresIn = 7200
+
 // Token 结构体用于存储访问令牌信息
 type Token struct {
-	AccessToken string    // 访问令牌
-	ClientID    string    // 客户端ID
-	UserID      string    // 用户ID
-	Scope       []string  // 权限范围，修改为字符串数组
-	Exp         time.Time // 过期时间
+	AccessToken string                 // 访问令牌
+	ClientID    string                 // 客户端ID
+	UserID      string                 // 用户ID
+	IdentityID  string                 // 以用户的多身份签发时的身份ID，为空时代表用户本身
+	ClientSub   string                 // 向客户端展示的主体标识，客户端使用 pairwise 主体时与用户ID不同
+	Scope       []string               // 权限范围，修改为字符串数组
+	FamilyID    string                 // 关联的刷新令牌族ID，没有刷新令牌时为空
+	Audience    string                 // 令牌的受众（资源标识），为空时为本服务
+	Format      string                 // 见 TokenFormatOpaque 等常量，为空时为 opaque
+	JTI         string                 // JWT 格式令牌的唯一标识
+	Act         map[string]interface{} // 令牌交换产生的 act 声明，没有委托时为空
+	JKT         string                 // 绑定的 DPoP 公钥指纹 (RFC 9449)，为空时为 Bearer 令牌
+	IssuedAt    time.Time              // 签发时间
+	Exp         time.Time              // 过期时间
 }
 
 var (
@@ -22,36 +43,73 @@ var (
 	tokenMutex sync.RWMutex
 )
 
+// IsSupportedTokenFormat 检查访问令牌格式是否受支持，空字符串表示使用默认格式
+func IsSupportedTokenFormat(format string) bool {
+	return format == "" || format == TokenFormatOpaque || format == TokenFormatJWT
+}
+
 // CreateToken 创建新的访问令牌并存储在内存中
-func CreateToken(clientID, userID string, scope []string, expiresIn ...int) (string, error) {
+// accessToken 中的 AccessToken、JTI、IssuedAt 与 Exp 由本函数生成，其余字段由调用方填写
+// JWT 格式的令牌同样保存在内存中，以便自省与吊销
+func CreateToken(accessToken Token, expiresIn ...int) (string, error) {
 	// 默认过期时间为2小时
-	exp := 7200
+	exp := DefaultTokenExpiresIn
 	if len(expiresIn) > 0 && expiresIn[0] > 0 {
 		exp = expiresIn[0]
 	}
 
-	token, err := untils.GenerateRandomCode(48, false) // 生成随机字符串作为访问令牌
+	now := time.Now()
+	accessToken.IssuedAt = now
+	accessToken.Exp = now.Add(time.Duration(exp) * time.Second)
+
+	var token string
+	var err error
+	if accessToken.Format == TokenFormatJWT {
+		token, err = issueJWTAccessToken(&accessToken)
+	} else {
+		token, err = untils.GenerateRandomCode(48, false) // 生成随机字符串作为访问令牌
+	}
 	if err != nil {
 		return "", err
 	}
-
-	// 创建令牌对象
-	accessToken := &Token{
-		AccessToken: token,
-		ClientID:    clientID,
-		UserID:      userID,
-		Scope:       scope,
-		Exp:         time.Now().Add(time.Duration(exp) * time.Second),
-	}
+	accessToken.AccessToken = token
 
 	// 存储到内存中
 	tokenMutex.Lock()
-	tokens[token] = accessToken
+	tokens[token] = &accessToken
 	tokenMutex.Unlock()
 
 	return token, nil
 }
 
+// issueJWTAccessToken 为令牌生成 jti 并签发 JWT
+func issueJWTAccessToken(accessToken *Token) (string, error) {
+	jti, err := untils.GenerateRandomCode(32, false)
+	if err != nil {
+		return "", err
+	}
+	accessToken.JTI = jti
+
+	// client_credentials 签发的令牌没有关联用户，sub 为客户端ID (RFC 9068 §2.2)
+	claims := jwt.MapClaims{
+		"sub":       accessToken.Subject(),
+		"aud":       accessToken.Audience,
+		"client_id": accessToken.ClientID,
+		"scope":     strings.Join(accessToken.Scope, " "),
+		"jti":       jti,
+		"iat":       accessToken.IssuedAt.Unix(),
+		"exp":       accessToken.Exp.Unix(),
+	}
+	if accessToken.Act != nil {
+		claims["act"] = accessToken.Act
+	}
+	if accessToken.JKT != "" {
+		claims["cnf"] = map[string]interface{}{"jkt": accessToken.JKT}
+	}
+
+	return helper.JwtHelper.IssueAccessToken(claims)
+}
+
 // CreateTokenFromString 为了兼容性，提供一个接收逗号分隔字符串的创建方法
 func CreateTokenFromString(clientID, userID, scopeStr string, expiresIn ...int) (string, error) {
 	var scope []string
@@ -60,7 +118,7 @@ func CreateTokenFromString(clientID, userID, scopeStr string, expiresIn ...int)
 	} else {
 		scope = []string{}
 	}
-	return CreateToken(clientID, userID, scope, expiresIn...)
+	return CreateToken(Token{ClientID: clientID, UserID: userID, Scope: scope}, expiresIn...)
 }
 
 // GetToken 通过访问令牌获取对应的信息
@@ -82,6 +140,14 @@ func (t *Token) HasScope(scope string) bool {
 	return ValidateScope(t.Scope, scope)
 }
 
+// TokenType 返回令牌类型，绑定了 DPoP 公钥的令牌为 DPoP，否则为 Bearer
+func (t *Token) TokenType() string {
+	if t.JKT != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
 // GetScopeString 获取逗号分隔的权限范围字符串
 func (t *Token) GetScopeString() string {
 	return strings.Join(t.Scope, ",")
@@ -94,6 +160,45 @@ func RemoveToken(token string) {
 	delete(tokens, token)
 }
 
+// RemoveTokensByFamily 移除属于指定刷新令牌族的所有访问令牌
+func RemoveTokensByFamily(familyID string) {
+	if familyID == "" {
+		return
+	}
+
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	for tokenStr, token := range tokens {
+		if token.FamilyID == familyID {
+			delete(tokens, tokenStr)
+		}
+	}
+}
+
+// RemoveTokensByClient 移除客户端签发的访问令牌，userID 为空时移除该客户端的全部访问令牌
+// 与被移除的令牌属于同一令牌族的令牌（如令牌交换签发给其他客户端的令牌）一并移除
+func RemoveTokensByClient(clientID, userID string) {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	familyIDs := make(map[string]bool)
+	for tokenStr, token := range tokens {
+		if token.ClientID == clientID && (userID == "" || token.UserID == userID) {
+			delete(tokens, tokenStr)
+			if token.FamilyID != "" {
+				familyIDs[token.FamilyID] = true
+			}
+		}
+	}
+
+	for tokenStr, token := range tokens {
+		if familyIDs[token.FamilyID] {
+			delete(tokens, tokenStr)
+		}
+	}
+}
+
 // 定期清理过期的访问令牌
 func init() {
 	go periodicCleanup(cleanupExpiredTokens, 15*time.Minute)
@@ -0,0 +1,47 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"nyauth_backed/source/untils"
+	"regexp"
+)
+
+// PKCE (RFC 7636) 支持的 code_challenge_method
+const (
+	CodeChallengeMethodS256  = "S256"
+	CodeChallengeMethodPlain = "plain"
+)
+
+// code_verifier 与 code_challenge 只允许 43-128 位的 unreserved 字符
+var pkceValuePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// IsSupportedCodeChallengeMethod 检查 code_challenge_method 是否受支持
+func IsSupportedCodeChallengeMethod(method string) bool {
+	return method == CodeChallengeMethodS256 || method == CodeChallengeMethodPlain
+}
+
+// IsValidCodeChallenge 检查 code_challenge 格式是否合法
+func IsValidCodeChallenge(challenge string) bool {
+	return pkceValuePattern.MatchString(challenge)
+}
+
+// VerifyCodeVerifier 使用 code_verifier 校验授权时提交的 code_challenge
+func VerifyCodeVerifier(verifier, challenge, method string) bool {
+	if !pkceValuePattern.MatchString(verifier) {
+		return false
+	}
+
+	var computed string
+	switch method {
+	case CodeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = untils.Base64URLEncode(sum[:])
+	case CodeChallengeMethodPlain:
+		computed = verifier
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
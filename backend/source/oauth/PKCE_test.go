@@ -0,0 +1,74 @@
+package oauth
+
+import (
+	"strings"
+	"testing"
+)
+
+// RFC 7636 附录 B 中的示例
+const (
+	rfcCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		want      bool
+	}{
+		{"S256", rfcCodeVerifier, rfcCodeChallenge, CodeChallengeMethodS256, true},
+		{"S256 错误的 verifier", strings.Replace(rfcCodeVerifier, "d", "e", 1), rfcCodeChallenge, CodeChallengeMethodS256, false},
+		{"plain", rfcCodeVerifier, rfcCodeVerifier, CodeChallengeMethodPlain, true},
+		{"plain 不匹配", rfcCodeVerifier, rfcCodeChallenge, CodeChallengeMethodPlain, false},
+		{"S256 的 challenge 不能当作 plain 使用", rfcCodeChallenge, rfcCodeChallenge, CodeChallengeMethodS256, false},
+		{"不支持的 method", rfcCodeVerifier, rfcCodeVerifier, "S512", false},
+		{"verifier 过短", "abc", "abc", CodeChallengeMethodPlain, false},
+		{"verifier 过长", strings.Repeat("a", 129), strings.Repeat("a", 129), CodeChallengeMethodPlain, false},
+		{"verifier 含非法字符", strings.Repeat("a", 42) + "+", strings.Repeat("a", 42) + "+", CodeChallengeMethodPlain, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyCodeVerifier(tt.verifier, tt.challenge, tt.method); got != tt.want {
+				t.Errorf("VerifyCodeVerifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidCodeChallenge(t *testing.T) {
+	tests := []struct {
+		challenge string
+		want      bool
+	}{
+		{rfcCodeChallenge, true},
+		{strings.Repeat("a", 43), true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 42), false},
+		{strings.Repeat("a", 129), false},
+		{strings.Repeat("a", 42) + "=", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidCodeChallenge(tt.challenge); got != tt.want {
+			t.Errorf("IsValidCodeChallenge(%q) = %v, want %v", tt.challenge, got, tt.want)
+		}
+	}
+}
+
+func TestIsSupportedCodeChallengeMethod(t *testing.T) {
+	for _, method := range []string{CodeChallengeMethodS256, CodeChallengeMethodPlain} {
+		if !IsSupportedCodeChallengeMethod(method) {
+			t.Errorf("IsSupportedCodeChallengeMethod(%q) = false, want true", method)
+		}
+	}
+	for _, method := range []string{"", "s256", "S512"} {
+		if IsSupportedCodeChallengeMethod(method) {
+			t.Errorf("IsSupportedCodeChallengeMethod(%q) = true, want false", method)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package oauth
+
+import (
+	"net/url"
+	"nyauth_backed/source/untils"
+	"sync"
+	"time"
+)
+
+// RFC 9126 request_uri 前缀
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PushedRequest 结构体用于存储客户端通过 PAR 端点提交的授权请求参数
+type PushedRequest struct {
+	RequestURI string     // 返回给客户端的 request_uri
+	ClientID   string     // 提交请求的客户端ID
+	Params     url.Values // 授权请求参数
+	Exp        time.Time  // 过期时间
+}
+
+var (
+	// 内存存储推送的授权请求
+	pushedRequests     = make(map[string]*PushedRequest)
+	pushedRequestMutex sync.RWMutex
+)
+
+// CreatePushedRequest 保存客户端提交的授权请求参数，返回 request_uri 与有效期（秒）
+func CreatePushedRequest(clientID string, params url.Values, expiresIn ...int) (string, int, error) {
+	// 默认过期时间为5分钟，需留出用户在前端确认授权的时间
+	exp := 300
+	if len(expiresIn) > 0 && expiresIn[0] > 0 {
+		exp = expiresIn[0]
+	}
+
+	code, err := untils.GenerateRandomCode(32, false)
+	if err != nil {
+		return "", 0, err
+	}
+	requestURI := RequestURIPrefix + code
+
+	pushedRequestMutex.Lock()
+	pushedRequests[requestURI] = &PushedRequest{
+		RequestURI: requestURI,
+		ClientID:   clientID,
+		Params:     params,
+		Exp:        time.Now().Add(time.Duration(exp) * time.Second),
+	}
+	pushedRequestMutex.Unlock()
+
+	return requestURI, exp, nil
+}
+
+// GetPushedRequest 查看推送的授权请求参数，不会使其失效
+func GetPushedRequest(requestURI, clientID string) (url.Values, bool) {
+	pushedRequestMutex.RLock()
+	defer pushedRequestMutex.RUnlock()
+
+	pushed, exists := pushedRequests[requestURI]
+	if !exists || pushed.ClientID != clientID || time.Now().After(pushed.Exp) {
+		return nil, false
+	}
+
+	return pushed.Params, true
+}
+
+// ConsumePushedRequest 取出推送的授权请求参数，request_uri 只能使用一次
+func ConsumePushedRequest(requestURI, clientID string) (url.Values, bool) {
+	pushedRequestMutex.Lock()
+	defer pushedRequestMutex.Unlock()
+
+	pushed, exists := pushedRequests[requestURI]
+	if !exists || pushed.ClientID != clientID || time.Now().After(pushed.Exp) {
+		return nil, false
+	}
+
+	delete(pushedRequests, requestURI)
+	return pushed.Params, true
+}
+
+// 定期清理过期的授权请求
+func init() {
+	go periodicCleanup(cleanupExpiredPushedRequests, 5*time.Minute)
+}
+
+// cleanupExpiredPushedRequests 清理过期的授权请求
+func cleanupExpiredPushedRequests() {
+	now := time.Now()
+	pushedRequestMutex.Lock()
+	defer pushedRequestMutex.Unlock()
+
+	for requestURI, pushed := range pushedRequests {
+		if now.After(pushed.Exp) {
+			delete(pushedRequests, requestURI)
+		}
+	}
+}
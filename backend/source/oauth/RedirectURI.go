@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+
+// MatchRedirectURI 检查请求的 redirect_uri 是否与已注册的任一 URI 匹配
+// 默认严格按字符串比较；回环地址 (127.0.0.1/[::1]) 允许任意端口 (RFC 8252 §7.3)
+func MatchRedirectURI(registered []string, requested string) bool {
+	for _, uri := range registered {
+		if uri == requested {
+			return true
+		}
+	}
+
+	requestedURL, err := url.Parse(requested)
+	if err != nil || !isLoopbackRedirect(requestedURL) {
+		return false
+	}
+
+	for _, uri := range registered {
+		registeredURL, err := url.Parse(uri)
+		if err != nil || !isLoopbackRedirect(registeredURL) {
+			continue
+		}
+		// 除端口外其余部分必须一致
+		if registeredURL.Hostname() == requestedURL.Hostname() &&
+			registeredURL.Path == requestedURL.Path &&
+			registeredURL.RawQuery == requestedURL.RawQuery {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateRedirectURI 校验注册时提交的 redirect_uri
+// 允许 https、回环地址上的 http，以及原生应用使用的私有 URI scheme (RFC 8252 §7.1)
+func ValidateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return ErrInvalidRedirectURI
+	}
+
+	// 重定向URI不能包含 fragment
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return ErrInvalidRedirectURI
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return ErrInvalidRedirectURI
+		}
+		return nil
+	case "http":
+		if !isLoopbackRedirect(u) {
+			return ErrInvalidRedirectURI
+		}
+		return nil
+	default:
+		// 私有 scheme 需使用反向域名形式，例如 com.example.app:/callback
+		if !strings.Contains(u.Scheme, ".") {
+			return ErrInvalidRedirectURI
+		}
+		return nil
+	}
+}
+
+// ValidateFrontchannelLogoutURI 校验注册的前端登出地址 (OIDC Front-Channel Logout)
+// 前端登出地址由用户的浏览器加载，允许 https 与回环地址上的 http
+func ValidateFrontchannelLogoutURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || strings.Contains(uri, "#") {
+		return ErrInvalidRedirectURI
+	}
+	if u.Scheme != "https" && !isLoopbackRedirect(u) {
+		return ErrInvalidRedirectURI
+	}
+	return nil
+}
+
+// ValidateBackchannelLogoutURI 校验注册的后端登出地址 (OIDC Back-Channel Logout)
+// 后端登出地址由服务器直接请求，只允许 https，且不能指向回环或内网地址
+func ValidateBackchannelLogoutURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.Fragment != "" || strings.Contains(uri, "#") {
+		return ErrInvalidRedirectURI
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrInvalidRedirectURI
+	}
+	// 域名解析到的地址在连接时再检查
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return ErrInvalidRedirectURI
+	}
+	return nil
+}
+
+// IsPublicIP 检查是否为公网地址，回环、内网、链路本地等地址均不是公网地址
+func IsPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// isLoopbackRedirect 检查是否为使用 IP 字面量的回环地址重定向URI
+func isLoopbackRedirect(u *url.URL) bool {
+	if u.Scheme != "http" {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
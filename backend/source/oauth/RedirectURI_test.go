@@ -0,0 +1,112 @@
+package oauth
+
+import "testing"
+
+func TestMatchRedirectURI(t *testing.T) {
+	registered := []string{
+		"https://app.example.com/callback",
+		"http://127.0.0.1/callback",
+		"http://[::1]:8080/cb?client=native",
+		"com.example.app:/callback",
+	}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      bool
+	}{
+		{"完全一致", "https://app.example.com/callback", true},
+		{"私有 scheme 完全一致", "com.example.app:/callback", true},
+		{"https 路径不同", "https://app.example.com/callback/other", false},
+		{"https 端口不同", "https://app.example.com:8443/callback", false},
+		{"https 多出查询参数", "https://app.example.com/callback?x=1", false},
+		{"IPv4 回环地址允许任意端口", "http://127.0.0.1:51234/callback", true},
+		{"IPv6 回环地址允许任意端口", "http://[::1]:1234/cb?client=native", true},
+		{"回环地址路径不同", "http://127.0.0.1:51234/other", false},
+		{"回环地址查询参数不同", "http://[::1]:1234/cb", false},
+		{"回环地址主机不同", "http://[::1]:51234/callback", false},
+		{"localhost 不按回环地址处理", "http://localhost:51234/callback", false},
+		{"回环地址不能使用 https 放宽端口", "https://127.0.0.1:51234/callback", false},
+		{"未注册", "https://evil.example.com/callback", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchRedirectURI(registered, tt.requested); got != tt.want {
+				t.Errorf("MatchRedirectURI(%q) = %v, want %v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"http://127.0.0.1/callback", true},
+		{"http://[::1]:8080/callback", true},
+		{"com.example.app:/callback", true},
+		{"http://app.example.com/callback", false},
+		{"http://localhost/callback", false},
+		{"https://app.example.com/callback#fragment", false},
+		{"https:///callback", false},
+		{"myapp:/callback", false},
+		{"/callback", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateRedirectURI(tt.uri); (err == nil) != tt.valid {
+			t.Errorf("ValidateRedirectURI(%q) error = %v, want valid = %v", tt.uri, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateFrontchannelLogoutURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/logout", true},
+		{"http://127.0.0.1:8080/logout", true},
+		{"http://app.example.com/logout", false},
+		{"https://app.example.com/logout#fragment", false},
+		{"com.example.app:/logout", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateFrontchannelLogoutURI(tt.uri); (err == nil) != tt.valid {
+			t.Errorf("ValidateFrontchannelLogoutURI(%q) error = %v, want valid = %v", tt.uri, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateBackchannelLogoutURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/backchannel", true},
+		{"https://203.0.113.10/backchannel", true},
+		{"http://app.example.com/backchannel", false},
+		{"http://127.0.0.1:8080/backchannel", false},
+		{"https://127.0.0.1/backchannel", false},
+		{"https://[::1]/backchannel", false},
+		{"https://localhost/backchannel", false},
+		{"https://api.localhost/backchannel", false},
+		{"https://10.0.0.1/backchannel", false},
+		{"https://192.168.1.1/backchannel", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://0.0.0.0/backchannel", false},
+		{"https://[fd00::1]/backchannel", false},
+		{"https://app.example.com/backchannel#fragment", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateBackchannelLogoutURI(tt.uri); (err == nil) != tt.valid {
+			t.Errorf("ValidateBackchannelLogoutURI(%q) error = %v, want valid = %v", tt.uri, err, tt.valid)
+		}
+	}
+}
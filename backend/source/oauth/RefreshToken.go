@@ -0,0 +1,177 @@
+package oauth
+
+import (
+	"errors"
+	"nyauth_backed/source/untils"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// RefreshToken 结构体用于存储刷新令牌信息
+type RefreshToken struct {
+	RefreshToken string    // 刷新令牌
+	ClientID     string    // 客户端ID
+	UserID       string    // 用户ID
+	IdentityID   string    // 以用户的多身份签发时的身份ID，轮换时沿用
+	ClientSub    string    // 向客户端展示的主体标识，轮换时沿用
+	Scope        []string  // 权限范围
+	FamilyID     string    // 令牌族ID，同一次授权轮换出的刷新令牌共享
+	JKT          string    // 绑定的 DPoP 公钥指纹，仅公开客户端的刷新令牌会绑定
+	IssuedAt     time.Time // 签发时间
+	Exp          time.Time // 过期时间
+}
+
+var (
+	// 内存存储有效的刷新令牌
+	refreshTokens = make(map[string]*RefreshToken)
+	// 已轮换的刷新令牌，用于检测重放，保留到其原本的过期时间
+	rotatedRefreshTokens = make(map[string]*RefreshToken)
+	refreshTokenMutex    sync.Mutex
+)
+
+// CreateRefreshToken 创建新的刷新令牌并存储在内存中
+// refreshToken 中的 RefreshToken 与 Exp 由本函数生成，FamilyID 为空时开启新的令牌族
+func CreateRefreshToken(refreshToken RefreshToken, expiresIn ...int) (string, error) {
+	// 默认过期时间为30天
+	exp := 30 * 24 * 3600
+	if len(expiresIn) > 0 && expiresIn[0] > 0 {
+		exp = expiresIn[0]
+	}
+
+	token, err := untils.GenerateRandomCode(64, false) // 生成随机字符串作为刷新令牌
+	if err != nil {
+		return "", err
+	}
+
+	if refreshToken.FamilyID == "" {
+		familyID, err := NewFamilyID()
+		if err != nil {
+			return "", err
+		}
+		refreshToken.FamilyID = familyID
+	}
+
+	now := time.Now()
+	refreshToken.RefreshToken = token
+	refreshToken.IssuedAt = now
+	refreshToken.Exp = now.Add(time.Duration(exp) * time.Second)
+
+	refreshTokenMutex.Lock()
+	refreshTokens[token] = &refreshToken
+	refreshTokenMutex.Unlock()
+
+	return token, nil
+}
+
+// NewFamilyID 生成新的令牌族ID
+func NewFamilyID() (string, error) {
+	return untils.GenerateRandomCode(32, false)
+}
+
+// GetRefreshToken 通过刷新令牌获取对应的信息
+func GetRefreshToken(token string) (*RefreshToken, bool) {
+	refreshTokenMutex.Lock()
+	defer refreshTokenMutex.Unlock()
+
+	refreshToken, exists := refreshTokens[token]
+	if !exists || time.Now().After(refreshToken.Exp) {
+		return nil, false
+	}
+
+	return refreshToken, true
+}
+
+// RotateRefreshToken 使用刷新令牌，成功后旧令牌立即失效
+// 若旧令牌被重复使用，则视为泄露并吊销整个令牌族
+func RotateRefreshToken(token, clientID string) (*RefreshToken, error) {
+	refreshTokenMutex.Lock()
+	defer refreshTokenMutex.Unlock()
+
+	if used, exists := rotatedRefreshTokens[token]; exists {
+		revokeFamilyLocked(used.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	refreshToken, exists := refreshTokens[token]
+	if !exists || time.Now().After(refreshToken.Exp) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	// 不属于该客户端的刷新令牌不予处理，也不会被消耗
+	if refreshToken.ClientID != clientID {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	delete(refreshTokens, token)
+	rotatedRefreshTokens[token] = refreshToken
+
+	return refreshToken, nil
+}
+
+// RevokeTokenFamily 吊销整个令牌族，包括其中的刷新令牌与访问令牌
+func RevokeTokenFamily(familyID string) {
+	refreshTokenMutex.Lock()
+	defer refreshTokenMutex.Unlock()
+	revokeFamilyLocked(familyID)
+}
+
+// RevokeClientTokens 吊销客户端签发的刷新令牌、访问令牌、未兑换的授权码与设备授权，userID 为空时吊销该客户端的全部令牌
+// 通过令牌交换签发给其他客户端的令牌沿用原令牌族，随令牌族一并吊销
+func RevokeClientTokens(clientID, userID string) {
+	familyIDs := []string{}
+	refreshTokenMutex.Lock()
+	for tokenStr, refreshToken := range refreshTokens {
+		if refreshToken.ClientID == clientID && (userID == "" || refreshToken.UserID == userID) {
+			delete(refreshTokens, tokenStr)
+			rotatedRefreshTokens[tokenStr] = refreshToken
+			familyIDs = append(familyIDs, refreshToken.FamilyID)
+		}
+	}
+	refreshTokenMutex.Unlock()
+
+	RemoveTokensByClient(clientID, userID)
+	for _, familyID := range familyIDs {
+		RemoveTokensByFamily(familyID)
+	}
+	RemoveAuthorizationCodesByClient(clientID, userID)
+	RemoveDeviceAuthorizationsByClient(clientID, userID)
+}
+
+// revokeFamilyLocked 在持有锁的情况下吊销令牌族
+func revokeFamilyLocked(familyID string) {
+	for tokenStr, refreshToken := range refreshTokens {
+		if refreshToken.FamilyID == familyID {
+			delete(refreshTokens, tokenStr)
+			rotatedRefreshTokens[tokenStr] = refreshToken
+		}
+	}
+	RemoveTokensByFamily(familyID)
+}
+
+// 定期清理过期的刷新令牌
+func init() {
+	go periodicCleanup(cleanupExpiredRefreshTokens, 30*time.Minute)
+}
+
+// cleanupExpiredRefreshTokens 清理过期的刷新令牌及轮换记录
+func cleanupExpiredRefreshTokens() {
+	now := time.Now()
+	refreshTokenMutex.Lock()
+	defer refreshTokenMutex.Unlock()
+
+	for tokenStr, refreshToken := range refreshTokens {
+		if now.After(refreshToken.Exp) {
+			delete(refreshTokens, tokenStr)
+		}
+	}
+	for tokenStr, refreshToken := range rotatedRefreshTokens {
+		if now.After(refreshToken.Exp) {
+			delete(rotatedRefreshTokens, tokenStr)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"nyauth_backed/source/untils"
+	"sync"
+	"time"
+)
+
+// Session 结构体用于记录一次登录会话中用户授权过的客户端，用于登出时通知这些客户端
+type Session struct {
+	SessionID string            // 会话ID，与门户 JWT 中的 session_id 以及 ID 令牌中的 sid 一致
+	UserID    string            // 用户ID
+	Clients   map[string]string // 客户端ID -> 签发给该客户端的 sub
+	Exp       time.Time         // 过期时间，与门户 JWT 一致
+}
+
+var (
+	// 内存存储登录会话，以及已登出但门户 JWT 尚未过期的会话ID
+	sessions      = make(map[string]*Session)
+	endedSessions = make(map[string]time.Time)
+	sessionMutex  sync.Mutex
+)
+
+// NewSessionID 生成新的会话ID，在用户登录签发门户 JWT 时调用
+func NewSessionID() (string, error) {
+	return untils.GenerateRandomCode(32, false)
+}
+
+// AddSessionClient 记录会话中向客户端签发过令牌，会话不存在时一并创建
+func AddSessionClient(sessionID, userID, clientID, subject string, exp time.Time) {
+	if sessionID == "" {
+		return
+	}
+
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	session, exists := sessions[sessionID]
+	if !exists {
+		session = &Session{
+			SessionID: sessionID,
+			UserID:    userID,
+			Clients:   make(map[string]string),
+			Exp:       exp,
+		}
+		sessions[sessionID] = session
+	}
+	session.Clients[clientID] = subject
+}
+
+// EndSession 结束会话，会话ID在 exp 之前都会被视为已登出
+// 返回会话中授权过的客户端，会话不存在时返回 nil
+func EndSession(sessionID string, exp time.Time) *Session {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	endedSessions[sessionID] = exp
+
+	session, exists := sessions[sessionID]
+	if !exists {
+		return nil
+	}
+	delete(sessions, sessionID)
+	return session
+}
+
+// IsSessionEnded 检查会话是否已经登出
+func IsSessionEnded(sessionID string) bool {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	exp, exists := endedSessions[sessionID]
+	return exists && time.Now().Before(exp)
+}
+
+// 定期清理过期的会话
+func init() {
+	go periodicCleanup(cleanupExpiredSessions, 15*time.Minute)
+}
+
+// cleanupExpiredSessions 清理过期的会话与登出记录
+func cleanupExpiredSessions() {
+	now := time.Now()
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	for sessionID, session := range sessions {
+		if now.After(session.Exp) {
+			delete(sessions, sessionID)
+		}
+	}
+	for sessionID, exp := range endedSessions {
+		if now.After(exp) {
+			delete(endedSessions, sessionID)
+		}
+	}
+}
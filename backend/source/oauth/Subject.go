@@ -0,0 +1,36 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"nyauth_backed/source/untils"
+)
+
+// 主体标识类型 (OIDC Core §8)
+const (
+	SubjectTypePublic   = "public"   // 所有应用看到相同的用户ID
+	SubjectTypePairwise = "pairwise" // 不同扇区看到不同的标识，应用之间无法关联同一用户
+)
+
+// IsSupportedSubjectType 检查主体标识类型是否受支持，空字符串表示 public
+func IsSupportedSubjectType(subjectType string) bool {
+	return subjectType == "" || subjectType == SubjectTypePublic || subjectType == SubjectTypePairwise
+}
+
+// PairwiseSubject 根据扇区标识与用户的 UUID 计算 pairwise 主体标识 (OIDC Core §8.1)
+// 使用服务端密钥做 HMAC-SHA256，不知道密钥时无法由标识反推用户，也无法关联不同扇区的标识
+func PairwiseSubject(sector, userUUID, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(sector))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userUUID))
+	return untils.Base64URLEncode(mac.Sum(nil))
+}
+
+// Subject 返回刷新令牌代表的主体，未记录向客户端展示的主体标识时为用户ID
+func (t *RefreshToken) Subject() string {
+	if t.ClientSub != "" {
+		return t.ClientSub
+	}
+	return t.UserID
+}
@@ -0,0 +1,54 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestPairwiseSubject(t *testing.T) {
+	const secret = "pairwise-secret"
+	sub := PairwiseSubject("app.example.com", "user-uuid", secret)
+
+	// HMAC-SHA256(secret, sector || 0x00 || uuid)，base64url 无填充
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("app.example.com\x00user-uuid"))
+	if want := base64.RawURLEncoding.EncodeToString(mac.Sum(nil)); sub != want {
+		t.Errorf("PairwiseSubject() = %q, want %q", sub, want)
+	}
+
+	if again := PairwiseSubject("app.example.com", "user-uuid", secret); again != sub {
+		t.Errorf("PairwiseSubject() is not stable: %q != %q", again, sub)
+	}
+
+	tests := []struct {
+		name                   string
+		sector, uuid, secretIn string
+	}{
+		{"不同扇区", "other.example.com", "user-uuid", secret},
+		{"不同用户", "app.example.com", "other-uuid", secret},
+		{"不同密钥", "app.example.com", "user-uuid", "other-secret"},
+		// 分隔符防止扇区与用户拼接后产生相同的输入
+		{"拼接歧义", "app.example.comuser", "-uuid", secret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PairwiseSubject(tt.sector, tt.uuid, tt.secretIn); got == sub {
+				t.Errorf("PairwiseSubject(%q, %q) collides with the base subject", tt.sector, tt.uuid)
+			}
+		})
+	}
+}
+
+func TestIsSupportedSubjectType(t *testing.T) {
+	for _, subjectType := range []string{"", SubjectTypePublic, SubjectTypePairwise} {
+		if !IsSupportedSubjectType(subjectType) {
+			t.Errorf("IsSupportedSubjectType(%q) = false, want true", subjectType)
+		}
+	}
+	if IsSupportedSubjectType("private") {
+		t.Error(`IsSupportedSubjectType("private") = true, want false`)
+	}
+}
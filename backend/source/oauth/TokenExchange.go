@@ -0,0 +1,35 @@
+package oauth
+
+// RFC 8693 令牌交换授权类型
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// RFC 8693 §3 令牌类型标识
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Subject 返回令牌代表的主体
+// 优先使用向客户端展示的主体标识，其次为身份ID、用户ID，client_credentials 签发的令牌为客户端ID
+func (t *Token) Subject() string {
+	if t.ClientSub != "" {
+		return t.ClientSub
+	}
+	if t.IdentityID != "" {
+		return t.IdentityID
+	}
+	if t.UserID != "" {
+		return t.UserID
+	}
+	return t.ClientID
+}
+
+// NewActClaim 构造委托场景下的 act 声明 (RFC 8693 §4.1)
+// actor 为当前行为方的主体，prior 为被交换令牌中已有的 act 声明，作为嵌套的前序行为方保留
+func NewActClaim(actor string, prior map[string]interface{}) map[string]interface{} {
+	act := map[string]interface{}{"sub": actor}
+	if prior != nil {
+		act["act"] = prior
+	}
+	return act
+}
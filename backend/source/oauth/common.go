@@ -5,6 +5,27 @@ import (
 	"time"
 )
 
+// ScopeOfflineAccess 请求刷新令牌所需的权限范围
+const ScopeOfflineAccess = "offline_access"
+
+// oidcScopePermissions 标准 OIDC 权限范围所需的应用权限，值为空表示任何应用都可以申请
+var oidcScopePermissions = map[string]string{
+	"openid":           "",
+	ScopeOfflineAccess: "",
+	"profile":          "user:info",
+	"email":            "user:email",
+}
+
+// ScopePermission 返回标准 OIDC 权限范围所需的应用权限，非 OIDC 权限范围返回 false
+// 返回的权限为空字符串时表示任何应用都可以申请该权限范围
+func ScopePermission(scope string) (string, bool) {
+	permission, isOIDCScope := oidcScopePermissions[scope]
+	return permission, isOIDCScope
+}
+
+// KnownPermissions 服务端定义的应用权限，应用只能申请其中的权限
+var KnownPermissions = []string{"user:info", "user:email"}
+
 // periodicCleanup 定期执行清理函数
 func periodicCleanup(cleanupFunc func(), interval time.Duration) {
 	for {
@@ -31,3 +52,54 @@ func ValidateScope(userPermissions []string, targetPermission string) bool {
 	}
 	return false
 }
+
+// ParseScope 解析以空格分隔的 scope 参数，并去除重复项
+func ParseScope(scope string) []string {
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// ContainsScope 检查权限范围列表中是否精确包含指定项
+func ContainsScope(scopes []string, target string) bool {
+	for _, s := range scopes {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantScope 计算请求的权限范围与应用权限的交集
+// 返回被授予的权限范围，以及应用无权申请的权限范围
+func GrantScope(requested []string, permissions []string) (granted []string, invalid []string) {
+	granted = []string{}
+	for _, scope := range requested {
+		required, isOIDCScope := oidcScopePermissions[scope]
+		switch {
+		case isOIDCScope && (required == "" || ValidateScope(permissions, required)):
+			granted = append(granted, scope)
+		case !isOIDCScope && ValidateScope(permissions, scope):
+			granted = append(granted, scope)
+		default:
+			invalid = append(invalid, scope)
+		}
+	}
+	return granted, invalid
+}
+
+// CoversScope 检查已授予的权限范围是否包含请求的全部权限范围
+func CoversScope(granted []string, requested []string) bool {
+	for _, scope := range requested {
+		if !ContainsScope(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
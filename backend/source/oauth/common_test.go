@@ -0,0 +1,121 @@
+package oauth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  []string
+	}{
+		{"", []string{}},
+		{"openid", []string{"openid"}},
+		{"openid  profile\temail", []string{"openid", "profile", "email"}},
+		{"openid profile openid", []string{"openid", "profile"}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseScope(tt.scope); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseScope(%q) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	permissions := []string{"user:info", "repo:*"}
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"user:info", true},
+		{"user:email", false},
+		{"repo:read", true},
+		{"repo:write", true},
+		{"repo", false},
+		{"repository:read", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidateScope(permissions, tt.target); got != tt.want {
+			t.Errorf("ValidateScope(%v, %q) = %v, want %v", permissions, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestGrantScope(t *testing.T) {
+	tests := []struct {
+		name        string
+		requested   []string
+		permissions []string
+		granted     []string
+		invalid     []string
+	}{
+		{
+			name:        "无需权限的 OIDC 范围",
+			requested:   []string{"openid", ScopeOfflineAccess},
+			permissions: []string{},
+			granted:     []string{"openid", ScopeOfflineAccess},
+		},
+		{
+			name:        "OIDC 范围按所需权限授予",
+			requested:   []string{"openid", "profile", "email"},
+			permissions: []string{"user:info"},
+			granted:     []string{"openid", "profile"},
+			invalid:     []string{"email"},
+		},
+		{
+			name:        "通配符权限",
+			requested:   []string{"email", "user:info"},
+			permissions: []string{"user:*"},
+			granted:     []string{"email", "user:info"},
+		},
+		{
+			name:        "超出应用权限",
+			requested:   []string{"user:info", "admin:all"},
+			permissions: []string{"user:info"},
+			granted:     []string{"user:info"},
+			invalid:     []string{"admin:all"},
+		},
+		{
+			name:        "空请求",
+			requested:   []string{},
+			permissions: []string{"user:info"},
+			granted:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granted, invalid := GrantScope(tt.requested, tt.permissions)
+			if !slices.Equal(granted, tt.granted) {
+				t.Errorf("GrantScope() granted = %v, want %v", granted, tt.granted)
+			}
+			if !slices.Equal(invalid, tt.invalid) {
+				t.Errorf("GrantScope() invalid = %v, want %v", invalid, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestCoversScope(t *testing.T) {
+	granted := []string{"openid", "profile"}
+
+	tests := []struct {
+		requested []string
+		want      bool
+	}{
+		{[]string{}, true},
+		{[]string{"openid"}, true},
+		{[]string{"openid", "profile"}, true},
+		{[]string{"openid", "email"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := CoversScope(granted, tt.requested); got != tt.want {
+			t.Errorf("CoversScope(%v, %v) = %v, want %v", granted, tt.requested, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handles
+
+import (
+	"fmt"
+	"net/http"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/oauth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GetAuthorizedApps 获取当前用户授权过的应用及已同意的权限范围
+func GetAuthorizedApps(c *gin.Context) {
+	// 从JWT中获取当前用户ID
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		SendResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return
+	}
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
+
+	authorizations, err := database.GetAuthorizationsByUser(userID)
+	if err != nil {
+		fmt.Printf("GetAuthorizationsByUser err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "获取授权列表失败", nil)
+		return
+	}
+
+	apps := []gin.H{}
+	for _, authorization := range authorizations {
+		dbClient, err := database.GetClientByClientID(authorization.ClientID)
+		if err != nil {
+			fmt.Printf("GetClientByClientID err: %s\n", err.Error())
+			continue
+		}
+		// 应用已被删除
+		if dbClient == nil {
+			continue
+		}
+
+		apps = append(apps, gin.H{
+			"client_id":   authorization.ClientID,
+			"client_name": dbClient.ClientName,
+			"avatar":      dbClient.Avatar,
+			"description": dbClient.Description,
+			"status":      dbClient.Status,
+			"scope":       authorization.Scope,
+			"created_at":  authorization.CreatedAt,
+			"updated_at":  authorization.UpdatedAt,
+		})
+	}
+
+	SendResponse(c, http.StatusOK, "获取授权列表成功", gin.H{
+		"apps": apps,
+	})
+}
+
+// RevokeAuthorizedApp 撤销对应用的授权，并吊销该应用为当前用户签发的全部令牌
+func RevokeAuthorizedApp(c *gin.Context) {
+	// 从JWT中获取当前用户ID
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		SendResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return
+	}
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
+
+	clientID := c.Param("client_id")
+	deleted, err := database.DeleteAuthorization(userID, clientID)
+	if err != nil {
+		fmt.Printf("DeleteAuthorization err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "撤销授权失败", nil)
+		return
+	}
+
+	if !deleted {
+		SendResponse(c, http.StatusNotFound, "没有授权过这个应用哦", nil)
+		return
+	}
+
+	oauth.RevokeClientTokens(clientID, userID)
+
+	SendResponse(c, http.StatusOK, "撤销授权成功", nil)
+}
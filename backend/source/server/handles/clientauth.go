@@ -0,0 +1,296 @@
+package handles
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"nyauth_backed/source"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"nyauth_backed/source/untils"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RFC 7523 客户端断言类型
+const clientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// 支持的客户端认证方式
+var tokenEndpointAuthMethods = []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"}
+
+// authenticateClient 验证令牌端点、自省端点与吊销端点的客户端身份
+// 支持 client_secret_basic、client_secret_post、private_key_jwt，公开客户端使用 none
+// 验证失败时已按 RFC 6749 §5.2 写入错误响应，调用方直接返回即可
+func authenticateClient(c *gin.Context) (*models.DatabaseClient, bool) {
+	clientID, method, credential, ok := parseClientCredentials(c)
+	if !ok {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "malformed or conflicting client authentication")
+		return nil, false
+	}
+
+	if clientID == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "client_id is required")
+		return nil, false
+	}
+
+	// 客户端ID不是合法的 ObjectID 时按不存在的客户端处理，包括 private_key_jwt 断言中的 sub
+	if _, err := bson.ObjectIDFromHex(clientID); err != nil {
+		sendInvalidClient(c, "unknown client")
+		return nil, false
+	}
+
+	// 验证客户端信息
+	client, err := database.GetClientByClientID(clientID)
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("GetClientByClientID err: %s\n", err.Error())
+		return nil, false
+	}
+
+	if client == nil {
+		sendInvalidClient(c, "unknown client")
+		return nil, false
+	}
+
+	if client.Status == models.ClientStatusDisabled {
+		sendInvalidClient(c, "client is disabled")
+		return nil, false
+	}
+
+	if !slices.Contains(clientAuthMethods(client), method) {
+		sendInvalidClient(c, "client authentication method is not allowed for this client")
+		return nil, false
+	}
+
+	switch method {
+	case "client_secret_basic", "client_secret_post":
+		if !verifyClientSecret(client, credential) {
+			sendInvalidClient(c, "client authentication failed")
+			return nil, false
+		}
+	case "private_key_jwt":
+		if err := verifyClientAssertion(c, client, credential); err != nil {
+			sendInvalidClient(c, "invalid client assertion")
+			fmt.Printf("verifyClientAssertion err: %s\n", err.Error())
+			return nil, false
+		}
+	}
+
+	return client, true
+}
+
+// parseClientCredentials 从请求中解析客户端ID、认证方式与凭据
+// 同时使用多种认证方式或 client_id 前后不一致时返回 false
+func parseClientCredentials(c *gin.Context) (clientID, method, credential string, ok bool) {
+	formClientID := c.PostForm("client_id")
+	formSecret := c.PostForm("client_secret")
+	assertionType := c.PostForm("client_assertion_type")
+	assertion := c.PostForm("client_assertion")
+
+	// client_secret_basic
+	if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Basic ") {
+		if formSecret != "" || assertion != "" {
+			return "", "", "", false
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authHeader, "Basic "))
+		if err != nil {
+			return "", "", "", false
+		}
+		id, secret, found := strings.Cut(string(raw), ":")
+		if !found {
+			return "", "", "", false
+		}
+		// 按 RFC 6749 §2.3.1，用户名与密码需先经过 form-urlencoded 编码
+		if id, err = url.QueryUnescape(id); err != nil {
+			return "", "", "", false
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return "", "", "", false
+		}
+		if formClientID != "" && formClientID != id {
+			return "", "", "", false
+		}
+		return id, "client_secret_basic", secret, true
+	}
+
+	// private_key_jwt
+	if assertion != "" || assertionType != "" {
+		if assertionType != clientAssertionTypeJWTBearer || assertion == "" || formSecret != "" {
+			return "", "", "", false
+		}
+		// client_id 可以省略，此时从断言的 sub 中读取，签名在之后验证
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+			return "", "", "", false
+		}
+		sub, _ := claims.GetSubject()
+		if formClientID != "" && formClientID != sub {
+			return "", "", "", false
+		}
+		return sub, "private_key_jwt", assertion, true
+	}
+
+	// client_secret_post
+	if formSecret != "" {
+		return formClientID, "client_secret_post", formSecret, true
+	}
+
+	return formClientID, "none", "", true
+}
+
+// clientAuthMethods 返回客户端允许使用的认证方式
+func clientAuthMethods(client *models.DatabaseClient) []string {
+	if client.PublicClient {
+		return []string{"none"}
+	}
+	if client.TokenEndpointAuthMethod != "" {
+		return []string{client.TokenEndpointAuthMethod}
+	}
+	return []string{"client_secret_basic", "client_secret_post"}
+}
+
+// 密钥最近使用时间的记录间隔，避免每次认证都写数据库
+const clientSecretTouchInterval = time.Minute
+
+// verifyClientSecret 校验客户端密钥，未过期的密钥中任意一个匹配即通过
+// 旧版单个密钥（明文或哈希）验证通过后会迁移到密钥列表中
+func verifyClientSecret(client *models.DatabaseClient, secret string) bool {
+	if secret == "" {
+		return false
+	}
+
+	secretHash := untils.SHA256(secret)
+	now := time.Now()
+
+	for _, s := range client.ClientSecrets {
+		if s.ExpiresAt != 0 && now.After(s.ExpiresAt.Time()) {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(secretHash), []byte(s.SecretHash)) != 1 {
+			continue
+		}
+		if now.Sub(s.LastUsedAt.Time()) > clientSecretTouchInterval {
+			if err := database.TouchClientSecret(client.ID.Hex(), s.SecretID); err != nil {
+				fmt.Printf("TouchClientSecret err: %s\n", err.Error())
+			}
+		}
+		return true
+	}
+
+	switch {
+	case client.ClientSecretHash != "":
+		if subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.ClientSecretHash)) != 1 {
+			return false
+		}
+	case client.ClientSecret != "":
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(client.ClientSecret)) != 1 {
+			return false
+		}
+	default:
+		return false
+	}
+
+	migrated, err := newClientSecretRecord(secretHash)
+	if err != nil {
+		fmt.Printf("newClientSecretRecord err: %s\n", err.Error())
+		return true
+	}
+	migrated.LastUsedAt = migrated.CreatedAt
+
+	err = database.UpdateClient(client.ID.Hex(), map[string]interface{}{
+		"client_secrets":     append(client.ClientSecrets, migrated),
+		"client_secret_hash": "",
+		"client_secret":      "",
+	})
+	if err != nil {
+		fmt.Printf("UpdateClient err: %s\n", err.Error())
+	}
+	return true
+}
+
+// generateClientSecret 生成新的客户端密钥，返回明文与待保存的记录，明文只应返回给调用方一次
+func generateClientSecret() (string, models.DatabaseClientSecret, error) {
+	secret, err := untils.GenerateRandomCode(48, false)
+	if err != nil {
+		return "", models.DatabaseClientSecret{}, err
+	}
+	record, err := newClientSecretRecord(untils.SHA256(secret))
+	if err != nil {
+		return "", models.DatabaseClientSecret{}, err
+	}
+	return secret, record, nil
+}
+
+// newClientSecretRecord 根据密钥哈希创建密钥记录
+func newClientSecretRecord(secretHash string) (models.DatabaseClientSecret, error) {
+	secretID, err := untils.GenerateRandomCode(16, false)
+	if err != nil {
+		return models.DatabaseClientSecret{}, err
+	}
+	return models.DatabaseClientSecret{
+		SecretID:   secretID,
+		SecretHash: secretHash,
+		CreatedAt:  bson.DateTime(time.Now().UnixNano() / int64(time.Millisecond)),
+	}, nil
+}
+
+// verifyClientAssertion 校验 private_key_jwt 客户端断言 (RFC 7523)
+// iss 与 sub 必须为 client_id，aud 必须为签发者或当前端点，jti 不能重复使用
+func verifyClientAssertion(c *gin.Context, client *models.DatabaseClient, assertion string) error {
+	clientID := client.ID.Hex()
+
+	keys, err := helper.ParseJWKSet(client.JWKS)
+	if err != nil {
+		return err
+	}
+
+	claims, err := helper.ParseJWTWithJWKS(assertion, keys,
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return err
+	}
+
+	baseURL := source.AppConfig.Server.BaseURL
+	allowedAudiences := []string{baseURL, baseURL + "/api/v0/oauth/token", baseURL + c.Request.URL.Path}
+	audiences, _ := claims.GetAudience()
+	matched := false
+	for _, aud := range audiences {
+		if slices.Contains(allowedAudiences, aud) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return errors.New("assertion audience mismatch")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return errors.New("assertion jti is missing")
+	}
+	exp, _ := claims.GetExpirationTime()
+
+	// 断言有效期不应过长，避免被长期重放
+	if time.Until(exp.Time) > time.Hour {
+		return errors.New("assertion lifetime is too long")
+	}
+
+	if !oauth.MarkJTIUsed("client_assertion:"+clientID+":"+jti, exp.Time) {
+		return errors.New("assertion jti has been used")
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package handles
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTokenRequestContext 构造携带表单与 Authorization 头的令牌端点请求
+func newTokenRequestContext(form url.Values, authorization string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v0/oauth/token", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if authorization != "" {
+		c.Request.Header.Set("Authorization", authorization)
+	}
+	return c
+}
+
+func basicAuth(clientID, secret string) string {
+	raw := url.QueryEscape(clientID) + ":" + url.QueryEscape(secret)
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+func TestParseClientCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// parseClientCredentials 不验证断言的签名，这里使用未签名的 JWT 即可
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "client-a"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("build assertion: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		form          url.Values
+		authorization string
+		clientID      string
+		method        string
+		credential    string
+		ok            bool
+	}{
+		{
+			name:          "client_secret_basic",
+			authorization: basicAuth("client-a", "s3cret"),
+			clientID:      "client-a",
+			method:        "client_secret_basic",
+			credential:    "s3cret",
+			ok:            true,
+		},
+		{
+			name:          "client_secret_basic 需要先解码 form-urlencoded",
+			authorization: basicAuth("client-a", "p@ss:word"),
+			clientID:      "client-a",
+			method:        "client_secret_basic",
+			credential:    "p@ss:word",
+			ok:            true,
+		},
+		{
+			name:          "client_secret_basic 与表单中的 client_id 一致",
+			form:          url.Values{"client_id": {"client-a"}},
+			authorization: basicAuth("client-a", "s3cret"),
+			clientID:      "client-a",
+			method:        "client_secret_basic",
+			credential:    "s3cret",
+			ok:            true,
+		},
+		{
+			name:          "client_secret_basic 与表单中的 client_id 不一致",
+			form:          url.Values{"client_id": {"client-b"}},
+			authorization: basicAuth("client-a", "s3cret"),
+		},
+		{
+			name:          "同时使用 client_secret_basic 与 client_secret_post",
+			form:          url.Values{"client_secret": {"s3cret"}},
+			authorization: basicAuth("client-a", "s3cret"),
+		},
+		{
+			name:          "Basic 头不是合法的 base64",
+			authorization: "Basic !!!",
+		},
+		{
+			name:          "Basic 头缺少分隔符",
+			authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("client-a")),
+		},
+		{
+			name:       "client_secret_post",
+			form:       url.Values{"client_id": {"client-a"}, "client_secret": {"s3cret"}},
+			clientID:   "client-a",
+			method:     "client_secret_post",
+			credential: "s3cret",
+			ok:         true,
+		},
+		{
+			name: "private_key_jwt 从 sub 读取 client_id",
+			form: url.Values{
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+			clientID:   "client-a",
+			method:     "private_key_jwt",
+			credential: assertion,
+			ok:         true,
+		},
+		{
+			name: "private_key_jwt 的 sub 与 client_id 不一致",
+			form: url.Values{
+				"client_id":             {"client-b"},
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+		},
+		{
+			name: "private_key_jwt 的断言类型不正确",
+			form: url.Values{
+				"client_assertion_type": {"urn:example:unknown"},
+				"client_assertion":      {assertion},
+			},
+		},
+		{
+			name: "private_key_jwt 同时提供密钥",
+			form: url.Values{
+				"client_secret":         {"s3cret"},
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {assertion},
+			},
+		},
+		{
+			name: "断言不是 JWT",
+			form: url.Values{
+				"client_assertion_type": {clientAssertionTypeJWTBearer},
+				"client_assertion":      {"not-a-jwt"},
+			},
+		},
+		{
+			name:     "公开客户端",
+			form:     url.Values{"client_id": {"client-a"}},
+			clientID: "client-a",
+			method:   "none",
+			ok:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.form == nil {
+				tt.form = url.Values{}
+			}
+			c := newTokenRequestContext(tt.form, tt.authorization)
+
+			clientID, method, credential, ok := parseClientCredentials(c)
+			if ok != tt.ok {
+				t.Fatalf("parseClientCredentials() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if clientID != tt.clientID || method != tt.method || credential != tt.credential {
+				t.Errorf("parseClientCredentials() = (%q, %q, %q), want (%q, %q, %q)",
+					clientID, method, credential, tt.clientID, tt.method, tt.credential)
+			}
+		})
+	}
+}
@@ -0,0 +1,558 @@
+package handles
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"nyauth_backed/source"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"nyauth_backed/source/untils"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CreateClient 创建新的应用，密钥只在创建时返回一次
+func CreateClient(c *gin.Context) {
+	// 从JWT中获取当前用户ID
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		SendResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return
+	}
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
+
+	var req models.ClientCredentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		SendResponse(c, http.StatusBadRequest, "请求参数错误", nil)
+		return
+	}
+
+	if msg := validateClientCredentials(&req); msg != "" {
+		SendResponse(c, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	dbClient := &models.DatabaseClient{
+		ClientName:   req.ClientName,
+		Description:  req.Description,
+		Avatar:       req.Avatar,
+		RedirectURIs: req.RedirectURIs,
+		Permissions:  req.Permissions,
+		GrantTypes:   req.GrantTypes,
+		PublicClient: req.PublicClient,
+		Status:       models.ClientStatusActive,
+		CreatedBy:    userID,
+		JWKS:         rawJWKS(req.JWKS),
+
+		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
+
+		RequirePushedAuthorizationRequests: req.RequirePushedAuthorizationRequests,
+		RequireSignedRequestObject:         req.RequireSignedRequestObject,
+		AccessTokenFormat:                  req.AccessTokenFormat,
+
+		SubjectType:         req.SubjectType,
+		SectorIdentifierURI: req.SectorIdentifierURI,
+
+		PostLogoutRedirectURIs:            req.PostLogoutRedirectURIs,
+		FrontchannelLogoutURI:             req.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: req.FrontchannelLogoutSessionRequired,
+		BackchannelLogoutURI:              req.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  req.BackchannelLogoutSessionRequired,
+	}
+
+	// 公开客户端不颁发密钥
+	var clientSecret string
+	if !req.PublicClient {
+		var secretRecord models.DatabaseClientSecret
+		var err error
+		clientSecret, secretRecord, err = generateClientSecret()
+		if err != nil {
+			SendResponse(c, http.StatusInternalServerError, "生成应用密钥失败", nil)
+			return
+		}
+		dbClient.ClientSecrets = []models.DatabaseClientSecret{secretRecord}
+	}
+
+	clientID, err := database.CreateClient(dbClient)
+	if err != nil {
+		fmt.Printf("CreateClient err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "创建应用失败", nil)
+		return
+	}
+
+	SendResponse(c, http.StatusOK, "创建应用成功，密钥只会显示这一次哦", gin.H{
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+	})
+}
+
+// GetClients 获取当前用户创建的所有应用
+func GetClients(c *gin.Context) {
+	// 从JWT中获取当前用户ID
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		SendResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return
+	}
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
+
+	clients, err := database.GetClientsByCreator(userID)
+	if err != nil {
+		fmt.Printf("GetClientsByCreator err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "获取应用列表失败", nil)
+		return
+	}
+
+	clientList := []gin.H{}
+	for i := range clients {
+		clientList = append(clientList, ownedClientInfo(&clients[i]))
+	}
+
+	SendResponse(c, http.StatusOK, "获取应用列表成功", gin.H{
+		"clients": clientList,
+	})
+}
+
+// UpdateClient 更新应用的名称、描述、头像、重定向URI与权限
+func UpdateClient(c *gin.Context) {
+	dbClient, ok := getOwnedClient(c)
+	if !ok {
+		return
+	}
+
+	var req models.ClientCredentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		SendResponse(c, http.StatusBadRequest, "请求参数错误", nil)
+		return
+	}
+
+	// 公开与机密类型在创建后不能修改
+	req.PublicClient = dbClient.PublicClient
+	if msg := validateClientCredentials(&req); msg != "" {
+		SendResponse(c, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	err := database.UpdateClient(dbClient.ID.Hex(), map[string]interface{}{
+		"client_name":   req.ClientName,
+		"description":   req.Description,
+		"avatar":        req.Avatar,
+		"redirect_uri":  "", // 旧版的单个重定向URI已合并进列表中提交
+		"redirect_uris": req.RedirectURIs,
+		"permissions":   req.Permissions,
+		"grant_types":   req.GrantTypes,
+		"jwks":          rawJWKS(req.JWKS),
+
+		"token_endpoint_auth_method": req.TokenEndpointAuthMethod,
+
+		"require_pushed_authorization_requests": req.RequirePushedAuthorizationRequests,
+		"require_signed_request_object":         req.RequireSignedRequestObject,
+		"access_token_format":                   req.AccessTokenFormat,
+
+		"subject_type":          req.SubjectType,
+		"sector_identifier_uri": req.SectorIdentifierURI,
+
+		"post_logout_redirect_uris":            req.PostLogoutRedirectURIs,
+		"frontchannel_logout_uri":              req.FrontchannelLogoutURI,
+		"frontchannel_logout_session_required": req.FrontchannelLogoutSessionRequired,
+		"backchannel_logout_uri":               req.BackchannelLogoutURI,
+		"backchannel_logout_session_required":  req.BackchannelLogoutSessionRequired,
+	})
+	if err != nil {
+		fmt.Printf("UpdateClient err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "更新应用失败", nil)
+		return
+	}
+
+	SendResponse(c, http.StatusOK, "更新应用成功", nil)
+}
+
+// DisableClient 停用应用，并吊销它签发的全部令牌
+func DisableClient(c *gin.Context) {
+	setClientStatus(c, models.ClientStatusDisabled)
+}
+
+// EnableClient 重新启用已停用的应用
+func EnableClient(c *gin.Context) {
+	setClientStatus(c, models.ClientStatusActive)
+}
+
+// DeleteClient 删除应用，并吊销它签发的全部令牌
+func DeleteClient(c *gin.Context) {
+	dbClient, ok := getOwnedClient(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DeleteClient(dbClient.ID.Hex()); err != nil {
+		fmt.Printf("DeleteClient err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "删除应用失败", nil)
+		return
+	}
+
+	oauth.RevokeClientTokens(dbClient.ID.Hex(), "")
+	if err := database.DeleteAuthorizationsByClient(dbClient.ID.Hex()); err != nil {
+		fmt.Printf("DeleteAuthorizationsByClient err: %s\n", err.Error())
+	}
+
+	SendResponse(c, http.StatusOK, "删除应用成功", nil)
+}
+
+// 轮换密钥时旧密钥默认继续有效的时间与允许的最长时间
+const (
+	defaultSecretGracePeriod = 24 * time.Hour
+	maxSecretGracePeriod     = 30 * 24 * time.Hour
+)
+
+// RotateClientSecret 为应用生成新的密钥，旧密钥在宽限期内仍然有效，新密钥只返回一次
+func RotateClientSecret(c *gin.Context) {
+	dbClient, ok := getOwnedClient(c)
+	if !ok {
+		return
+	}
+
+	if dbClient.PublicClient {
+		SendResponse(c, http.StatusBadRequest, "公开客户端没有密钥", nil)
+		return
+	}
+
+	var req models.ClientSecretRotation
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			SendResponse(c, http.StatusBadRequest, "请求参数错误", nil)
+			return
+		}
+	}
+
+	gracePeriod := defaultSecretGracePeriod
+	if req.GracePeriod != nil {
+		gracePeriod = time.Duration(*req.GracePeriod) * time.Second
+		if gracePeriod < 0 || gracePeriod > maxSecretGracePeriod {
+			SendResponse(c, http.StatusBadRequest, "grace_period 超出允许的范围", nil)
+			return
+		}
+	}
+
+	clientSecret, newSecret, err := generateClientSecret()
+	if err != nil {
+		SendResponse(c, http.StatusInternalServerError, "生成应用密钥失败", nil)
+		return
+	}
+
+	// 旧密钥的过期时间缩短到宽限期结束，已经更早过期的保持不变
+	graceEnd := bson.DateTime(time.Now().Add(gracePeriod).UnixNano() / int64(time.Millisecond))
+	secrets := []models.DatabaseClientSecret{}
+	if gracePeriod > 0 {
+		for _, s := range activeClientSecrets(dbClient) {
+			if s.ExpiresAt == 0 || s.ExpiresAt > graceEnd {
+				s.ExpiresAt = graceEnd
+			}
+			secrets = append(secrets, s)
+		}
+	}
+	secrets = append(secrets, newSecret)
+
+	err = database.UpdateClient(dbClient.ID.Hex(), map[string]interface{}{
+		"client_secrets":     secrets,
+		"client_secret_hash": "",
+		"client_secret":      "",
+	})
+	if err != nil {
+		fmt.Printf("UpdateClient err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "轮换应用密钥失败", nil)
+		return
+	}
+
+	SendResponse(c, http.StatusOK, "生成新密钥成功，密钥只会显示这一次哦", gin.H{
+		"client_id":     dbClient.ID.Hex(),
+		"client_secret": clientSecret,
+		"secret_id":     newSecret.SecretID,
+		"secrets":       clientSecretsInfo(secrets),
+	})
+}
+
+// RevokeClientSecret 立即吊销应用的某个密钥，至少需要保留一个有效的密钥
+func RevokeClientSecret(c *gin.Context) {
+	dbClient, ok := getOwnedClient(c)
+	if !ok {
+		return
+	}
+
+	secretID := c.Param("secret_id")
+	secrets := []models.DatabaseClientSecret{}
+	found := false
+	for _, s := range activeClientSecrets(dbClient) {
+		if s.SecretID == secretID {
+			found = true
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+
+	if !found {
+		SendResponse(c, http.StatusNotFound, "没有这个密钥哦", nil)
+		return
+	}
+
+	if len(secrets) == 0 {
+		SendResponse(c, http.StatusBadRequest, "至少需要保留一个有效的密钥，请先生成新密钥", nil)
+		return
+	}
+
+	err := database.UpdateClient(dbClient.ID.Hex(), map[string]interface{}{
+		"client_secrets":     secrets,
+		"client_secret_hash": "",
+		"client_secret":      "",
+	})
+	if err != nil {
+		fmt.Printf("UpdateClient err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "吊销应用密钥失败", nil)
+		return
+	}
+
+	SendResponse(c, http.StatusOK, "吊销应用密钥成功", gin.H{
+		"secrets": clientSecretsInfo(secrets),
+	})
+}
+
+// activeClientSecrets 返回应用当前未过期的密钥，旧版单个密钥以 secret_id 为 legacy 的记录返回
+func activeClientSecrets(dbClient *models.DatabaseClient) []models.DatabaseClientSecret {
+	now := bson.DateTime(time.Now().UnixNano() / int64(time.Millisecond))
+
+	secrets := []models.DatabaseClientSecret{}
+	for _, s := range dbClient.ClientSecrets {
+		if s.ExpiresAt == 0 || s.ExpiresAt > now {
+			secrets = append(secrets, s)
+		}
+	}
+
+	legacyHash := dbClient.ClientSecretHash
+	if legacyHash == "" && dbClient.ClientSecret != "" {
+		legacyHash = untils.SHA256(dbClient.ClientSecret)
+	}
+	if legacyHash != "" {
+		secrets = append(secrets, models.DatabaseClientSecret{
+			SecretID:   "legacy",
+			SecretHash: legacyHash,
+			CreatedAt:  dbClient.CreatedAt,
+		})
+	}
+
+	return secrets
+}
+
+// clientSecretsInfo 构造密钥列表信息，不包含密钥哈希
+func clientSecretsInfo(secrets []models.DatabaseClientSecret) []gin.H {
+	info := []gin.H{}
+	for _, s := range secrets {
+		info = append(info, gin.H{
+			"secret_id":    s.SecretID,
+			"created_at":   s.CreatedAt,
+			"expires_at":   s.ExpiresAt,
+			"last_used_at": s.LastUsedAt,
+		})
+	}
+	return info
+}
+
+// setClientStatus 修改应用状态，停用时吊销它签发的全部令牌
+func setClientStatus(c *gin.Context, status int) {
+	dbClient, ok := getOwnedClient(c)
+	if !ok {
+		return
+	}
+
+	err := database.UpdateClient(dbClient.ID.Hex(), map[string]interface{}{
+		"status": status,
+	})
+	if err != nil {
+		fmt.Printf("UpdateClient err: %s\n", err.Error())
+		SendResponse(c, http.StatusInternalServerError, "修改应用状态失败", nil)
+		return
+	}
+
+	if status == models.ClientStatusDisabled {
+		oauth.RevokeClientTokens(dbClient.ID.Hex(), "")
+	}
+
+	SendResponse(c, http.StatusOK, "修改应用状态成功", nil)
+}
+
+// getOwnedClient 获取路径中指定的、由当前用户创建的应用
+// 获取失败时已写入响应，调用方直接返回即可
+func getOwnedClient(c *gin.Context) (*models.DatabaseClient, bool) {
+	// 从JWT中获取当前用户ID
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		SendResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return nil, false
+	}
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
+
+	dbClient, err := database.GetClientByClientID(c.Param("client_id"))
+	if err != nil {
+		SendResponse(c, http.StatusBadRequest, "笨蛋！你..你放了什么东西进来❤", nil)
+		return nil, false
+	}
+
+	// 不属于当前用户的应用视为不存在
+	if dbClient == nil || dbClient.CreatedBy != userID {
+		SendResponse(c, http.StatusNotFound, "没有这个 client 哦", nil)
+		return nil, false
+	}
+
+	return dbClient, true
+}
+
+// 开发者自行创建的应用可以使用的授权类型，都需要用户确认授权
+// client_credentials 需要管理员在配置中开启，令牌交换只开放给配置中允许的动态注册客户端
+var portalGrantTypes = []string{"authorization_code", "refresh_token", oauth.GrantTypeDeviceCode}
+
+// validateClientCredentials 校验应用参数，返回错误信息，校验通过时返回空字符串
+func validateClientCredentials(req *models.ClientCredentials) string {
+	if req.RedirectURIs == nil {
+		req.RedirectURIs = []string{}
+	}
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+	if req.PostLogoutRedirectURIs == nil {
+		req.PostLogoutRedirectURIs = []string{}
+	}
+
+	for _, uri := range req.RedirectURIs {
+		if err := oauth.ValidateRedirectURI(uri); err != nil {
+			return "redirect_uri 不合法: " + uri
+		}
+	}
+
+	for _, perm := range req.Permissions {
+		if !slices.Contains(oauth.KnownPermissions, perm) {
+			return "不支持的权限: " + perm
+		}
+	}
+
+	for _, grantType := range req.GrantTypes {
+		if grantType == "client_credentials" && source.AppConfig.OAuth.PortalClientCredentials {
+			if req.PublicClient {
+				return "公开客户端不能使用 client_credentials"
+			}
+			continue
+		}
+		if !slices.Contains(portalGrantTypes, grantType) {
+			return "不支持的 grant_type: " + grantType
+		}
+	}
+
+	jwks := rawJWKS(req.JWKS)
+	if jwks != "" {
+		if _, err := helper.ParseJWKSet(jwks); err != nil {
+			return "jwks 不合法"
+		}
+	}
+	if req.RequireSignedRequestObject && jwks == "" {
+		return "要求签名的请求对象时必须提供 jwks"
+	}
+
+	// 公开客户端不持有任何凭据，认证方式固定为 none
+	if req.PublicClient {
+		if req.TokenEndpointAuthMethod != "" && req.TokenEndpointAuthMethod != "none" {
+			return "公开客户端不能设置 token_endpoint_auth_method"
+		}
+		req.TokenEndpointAuthMethod = ""
+	} else if req.TokenEndpointAuthMethod != "" {
+		if req.TokenEndpointAuthMethod == "none" || !slices.Contains(registrationAuthMethods, req.TokenEndpointAuthMethod) {
+			return "不支持的 token_endpoint_auth_method: " + req.TokenEndpointAuthMethod
+		}
+	}
+	if req.TokenEndpointAuthMethod == "private_key_jwt" && jwks == "" {
+		return "使用 private_key_jwt 时必须提供 jwks"
+	}
+
+	if !oauth.IsSupportedTokenFormat(req.AccessTokenFormat) {
+		return "不支持的 access_token_format: " + req.AccessTokenFormat
+	}
+
+	for _, uri := range req.PostLogoutRedirectURIs {
+		if err := oauth.ValidateRedirectURI(uri); err != nil {
+			return "post_logout_redirect_uri 不合法: " + uri
+		}
+	}
+	if req.FrontchannelLogoutURI != "" && oauth.ValidateFrontchannelLogoutURI(req.FrontchannelLogoutURI) != nil {
+		return "frontchannel_logout_uri 不合法"
+	}
+	if req.BackchannelLogoutURI != "" && oauth.ValidateBackchannelLogoutURI(req.BackchannelLogoutURI) != nil {
+		return "backchannel_logout_uri 不合法"
+	}
+
+	if !oauth.IsSupportedSubjectType(req.SubjectType) {
+		return "不支持的 subject_type: " + req.SubjectType
+	}
+	if req.SubjectType == oauth.SubjectTypePairwise && !pairwiseEnabled() {
+		return "服务器未启用 pairwise 主体标识"
+	}
+	if req.SectorIdentifierURI != "" {
+		if err := validateSectorIdentifier(req.SectorIdentifierURI, req.RedirectURIs); err != nil {
+			return "sector_identifier_uri 不合法: " + err.Error()
+		}
+	}
+
+	return ""
+}
+
+// rawJWKS 将请求中的 jwks 转换为保存的字符串，未提供时返回空字符串
+func rawJWKS(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// ownedClientInfo 构造返回给创建者的应用信息，不包含密钥
+func ownedClientInfo(dbClient *models.DatabaseClient) gin.H {
+	grantTypes := dbClient.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = defaultGrantTypes
+	}
+
+	info := gin.H{
+		"client_id":     dbClient.ID.Hex(),
+		"client_name":   dbClient.ClientName,
+		"description":   dbClient.Description,
+		"avatar":        dbClient.Avatar,
+		"redirect_uris": clientRedirectURIs(dbClient),
+		"permissions":   dbClient.Permissions,
+		"grant_types":   grantTypes,
+		"public_client": dbClient.PublicClient,
+		"secrets":       clientSecretsInfo(activeClientSecrets(dbClient)),
+		"status":        dbClient.Status,
+		"created_at":    dbClient.CreatedAt,
+		"updated_at":    dbClient.UpdatedAt,
+
+		"token_endpoint_auth_method": clientAuthMethods(dbClient)[0],
+
+		"require_pushed_authorization_requests": dbClient.RequirePushedAuthorizationRequests,
+		"require_signed_request_object":         dbClient.RequireSignedRequestObject,
+		"access_token_format":                   clientAccessTokenFormat(dbClient),
+
+		"subject_type":          clientSubjectType(dbClient),
+		"sector_identifier_uri": dbClient.SectorIdentifierURI,
+
+		"post_logout_redirect_uris":            dbClient.PostLogoutRedirectURIs,
+		"frontchannel_logout_uri":              dbClient.FrontchannelLogoutURI,
+		"frontchannel_logout_session_required": dbClient.FrontchannelLogoutSessionRequired,
+		"backchannel_logout_uri":               dbClient.BackchannelLogoutURI,
+		"backchannel_logout_session_required":  dbClient.BackchannelLogoutSessionRequired,
+	}
+	if dbClient.JWKS != "" {
+		info["jwks"] = json.RawMessage(dbClient.JWKS)
+	}
+	return info
+}
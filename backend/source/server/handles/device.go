@@ -0,0 +1,200 @@
+package handles
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"nyauth_backed/source"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OAuthDeviceAuthorization 设备授权端点 (RFC 8628 §3.1)，为无法跳转浏览器的设备签发设备码与用户码
+func OAuthDeviceAuthorization(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	client, ok := authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if !clientAllowsGrantType(client, oauth.GrantTypeDeviceCode) {
+		SendOAuthError(c, http.StatusBadRequest, "unauthorized_client", "the client is not allowed to use the device authorization grant")
+		return
+	}
+
+	// 请求的权限范围必须都在应用的权限之内
+	requestedScope := oauth.ParseScope(c.PostForm("scope"))
+	if _, invalid := oauth.GrantScope(requestedScope, client.Permissions); len(invalid) > 0 {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_scope", "scope not allowed for this client: "+strings.Join(invalid, " "))
+		return
+	}
+
+	da, err := oauth.CreateDeviceAuthorization(oauth.DeviceAuthorization{
+		ClientID: client.ID.Hex(),
+		Scope:    requestedScope,
+	})
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("CreateDeviceAuthorization err: %s\n", err.Error())
+		return
+	}
+
+	userCode := oauth.FormatUserCode(da.UserCode)
+	verificationURI := source.AppConfig.Server.BaseURL + "/oauth/device"
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_code":               da.DeviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		"expires_in":                int(time.Until(da.Exp).Seconds()),
+		"interval":                  da.Interval,
+	})
+}
+
+// GetDeviceVerification 用户输入用户码后，获取待确认的设备授权信息
+func GetDeviceVerification(c *gin.Context) {
+	da, exists := oauth.GetDeviceAuthorizationByUserCode(c.Query("user_code"))
+	if !exists {
+		SendResponse(c, http.StatusNotFound, "用户码无效或已过期", nil)
+		return
+	}
+
+	client, err := database.GetClientByClientID(da.ClientID)
+	if err != nil {
+		SendResponse(c, http.StatusInternalServerError, "服务器错误，无法验证客户端信息", nil)
+		fmt.Printf("GetClientByClientID err: %s\n", err.Error())
+		return
+	}
+
+	if client == nil || client.Status == models.ClientStatusDisabled {
+		SendResponse(c, http.StatusNotFound, "未找到指定的应用", nil)
+		return
+	}
+
+	SendResponse(c, http.StatusOK, "获取设备授权信息成功", gin.H{
+		"user_code":   oauth.FormatUserCode(da.UserCode),
+		"client_id":   client.ID.Hex(),
+		"client_name": client.ClientName,
+		"description": client.Description,
+		"avatar":      client.Avatar,
+		"scope":       da.Scope,
+		"expires_at":  da.Exp.Unix(),
+	})
+}
+
+// DeviceVerification 用户确认或拒绝设备授权
+func DeviceVerification(c *gin.Context) {
+	var req models.DeviceVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		SendResponse(c, http.StatusBadRequest, "请求参数错误", nil)
+		return
+	}
+
+	// 从上下文中获取用户ID
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		SendResponse(c, http.StatusUnauthorized, "JWT claims not found", nil)
+		return
+	}
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
+
+	da, exists := oauth.GetDeviceAuthorizationByUserCode(req.UserCode)
+	if !exists {
+		SendResponse(c, http.StatusNotFound, "用户码无效或已过期", nil)
+		return
+	}
+
+	// 登出令牌中的 sub 必须与签发给应用的ID令牌一致
+	var subject string
+	if req.Approve {
+		client, err := database.GetClientByClientID(da.ClientID)
+		if err != nil || client == nil {
+			SendResponse(c, http.StatusInternalServerError, "服务器错误，无法验证客户端信息", nil)
+			if err != nil {
+				fmt.Printf("GetClientByClientID err: %s\n", err.Error())
+			}
+			return
+		}
+		subject, err = clientSubject(client, userID, "")
+		if err != nil {
+			SendResponse(c, http.StatusInternalServerError, "获取用户标识失败", nil)
+			fmt.Printf("clientSubject err: %s\n", err.Error())
+			return
+		}
+	}
+
+	sessionID, sessionExp := portalSession(c)
+	if err := oauth.CompleteDeviceAuthorization(req.UserCode, userID, sessionID, portalAuthTime(claims.(jwt.MapClaims)), req.Approve); err != nil {
+		SendResponse(c, http.StatusNotFound, "用户码无效或已过期", nil)
+		return
+	}
+
+	if !req.Approve {
+		SendResponse(c, http.StatusOK, "已拒绝设备授权", nil)
+		return
+	}
+
+	// 记录会话中授权过的应用，用户登出时通知该应用
+	oauth.AddSessionClient(sessionID, userID, da.ClientID, subject, sessionExp)
+
+	// 设备码确认成功后才记录用户同意的权限范围，设备授权不改变此前在授权页面选择的身份
+	if err := database.AddAuthorizationScope(userID, da.ClientID, da.Scope); err != nil {
+		SendResponse(c, http.StatusInternalServerError, "保存授权记录失败", nil)
+		fmt.Printf("AddAuthorizationScope err: %s\n", err.Error())
+		return
+	}
+
+	SendResponse(c, http.StatusOK, "授权成功，请回到设备上继续操作", nil)
+}
+
+// deviceCodeGrant 处理 grant_type=urn:ietf:params:oauth:grant-type:device_code
+func deviceCodeGrant(c *gin.Context, client *models.DatabaseClient) {
+	deviceCode := c.PostForm("device_code")
+	if deviceCode == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "device_code is required")
+		return
+	}
+
+	// 资源不合法时不消耗设备码
+	audience, format, ok := accessTokenTarget(c, client, c.PostForm("resource"))
+	if !ok {
+		return
+	}
+
+	clientID := client.ID.Hex()
+
+	da, err := oauth.PollDeviceAuthorization(deviceCode, clientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, oauth.ErrAuthorizationPending):
+			SendOAuthError(c, http.StatusBadRequest, "authorization_pending", "")
+		case errors.Is(err, oauth.ErrSlowDown):
+			SendOAuthError(c, http.StatusBadRequest, "slow_down", "")
+		case errors.Is(err, oauth.ErrDeviceAccessDenied):
+			SendOAuthError(c, http.StatusBadRequest, "access_denied", "the user denied the authorization request")
+		case errors.Is(err, oauth.ErrDeviceCodeExpired):
+			SendOAuthError(c, http.StatusBadRequest, "expired_token", "device_code has expired")
+		default:
+			SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "device_code is invalid")
+		}
+		return
+	}
+
+	// 请求了 openid 时一并签发ID令牌
+	issueUserTokens(c, client, userGrant{
+		UserID:    da.UserID,
+		Scope:     da.Scope,
+		SessionID: da.SessionID,
+		AuthTime:  da.AuthTime,
+		IDToken:   oauth.ContainsScope(da.Scope, "openid"),
+	}, audience, format)
+}
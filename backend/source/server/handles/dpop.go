@@ -0,0 +1,137 @@
+package handles
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"nyauth_backed/source"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoP 证明的有效时间窗口，iat 早于该时间或晚于当前时间 dpopProofClockSkew 的证明会被拒绝
+const (
+	dpopProofLifetime  = 5 * time.Minute
+	dpopProofClockSkew = time.Minute
+)
+
+// dpopProofKey 从上下文中读取令牌端点验证过的 DPoP 公钥指纹的键
+const dpopProofKey = "dpopJKT"
+
+// verifyDPoPProof 验证请求中的 DPoP 证明 (RFC 9449 §4.3)，返回证明公钥的 JWK 指纹
+// 请求没有 DPoP 头时返回空字符串；accessToken 不为空时同时校验证明中的 ath
+func verifyDPoPProof(c *gin.Context, accessToken string) (string, error) {
+	proofs := c.Request.Header.Values("DPoP")
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	if len(proofs) > 1 {
+		return "", errors.New("multiple DPoP proofs")
+	}
+
+	var jkt string
+	token, err := jwt.Parse(proofs[0], func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+
+		// 证明由头部携带的公钥签名，公钥中不能包含私钥成员
+		rawJWK, exists := token.Header["jwk"].(map[string]interface{})
+		if !exists {
+			return nil, errors.New("jwk header is required")
+		}
+		if _, exists := rawJWK["d"]; exists {
+			return nil, errors.New("jwk header must not contain a private key")
+		}
+		data, err := json.Marshal(rawJWK)
+		if err != nil {
+			return nil, err
+		}
+		var key helper.JSONWebKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return nil, err
+		}
+
+		jkt, err = key.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		return key.PublicKey()
+	}, jwt.WithValidMethods(helper.ClientSigningAlgs))
+	if err != nil {
+		return "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", errors.New("unexpected claims type")
+	}
+
+	if htm, _ := claims["htm"].(string); htm != c.Request.Method {
+		return "", errors.New("htm does not match the request method")
+	}
+	htu, _ := claims["htu"].(string)
+	if !dpopHTUMatches(htu, source.AppConfig.Server.BaseURL+c.Request.URL.Path) {
+		return "", errors.New("htu does not match the request uri")
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return "", errors.New("iat is required")
+	}
+	now := time.Now()
+	if iat.Before(now.Add(-dpopProofLifetime)) || iat.After(now.Add(dpopProofClockSkew)) {
+		return "", errors.New("proof is expired or issued in the future")
+	}
+
+	// 同一个证明只能使用一次
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", errors.New("jti is required")
+	}
+	if !oauth.MarkJTIUsed("dpop:"+jkt+":"+jti, iat.Add(dpopProofLifetime+dpopProofClockSkew)) {
+		return "", errors.New("proof has already been used")
+	}
+
+	// 访问受保护资源时，证明必须与所出示的访问令牌绑定
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", errors.New("ath does not match the access token")
+		}
+	}
+
+	return jkt, nil
+}
+
+// dpopHTUMatches 比较证明中的 htu 与请求地址，忽略查询参数与片段
+func dpopHTUMatches(htu, requestURI string) bool {
+	parsed, err := url.Parse(htu)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String() == requestURI
+}
+
+// refreshTokenJKT 返回刷新令牌需要绑定的 DPoP 公钥指纹
+// 公开客户端的刷新令牌同样绑定到 DPoP 公钥 (RFC 9449 §5)，机密客户端的刷新令牌已由客户端认证约束
+func refreshTokenJKT(c *gin.Context, client *models.DatabaseClient) string {
+	if !client.PublicClient {
+		return ""
+	}
+	return dpopJKT(c)
+}
+
+// dpopJKT 返回令牌端点验证过的 DPoP 公钥指纹，请求没有使用 DPoP 时为空
+func dpopJKT(c *gin.Context) string {
+	return c.GetString(dpopProofKey)
+}
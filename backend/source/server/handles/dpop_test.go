@@ -0,0 +1,164 @@
+package handles
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"nyauth_backed/source"
+	"nyauth_backed/source/helper"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDPoPHTUMatches(t *testing.T) {
+	const requestURI = "https://auth.example.com/api/v0/oauth/token"
+
+	tests := []struct {
+		htu  string
+		want bool
+	}{
+		{"https://auth.example.com/api/v0/oauth/token", true},
+		{"https://auth.example.com/api/v0/oauth/token?x=1", true},
+		{"https://auth.example.com/api/v0/oauth/token#frag", true},
+		{"https://auth.example.com/api/v0/oauth/userinfo", false},
+		{"http://auth.example.com/api/v0/oauth/token", false},
+		{"https://evil.example.com/api/v0/oauth/token", false},
+		{"/api/v0/oauth/token", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := dpopHTUMatches(tt.htu, requestURI); got != tt.want {
+			t.Errorf("dpopHTUMatches(%q) = %v, want %v", tt.htu, got, tt.want)
+		}
+	}
+}
+
+// dpopTestKey 生成 DPoP 证明使用的密钥及其 JWK
+func dpopTestKey(t *testing.T) (*ecdsa.PrivateKey, helper.JSONWebKey) {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return privateKey, helper.JSONWebKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(privateKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(privateKey.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// signDPoPProof 使用给定的头部与声明签发 DPoP 证明
+func signDPoPProof(t *testing.T, privateKey *ecdsa.PrivateKey, header map[string]interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	for key, value := range header {
+		token.Header[key] = value
+	}
+	proof, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return proof
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	source.AppConfig = &source.Config{Server: source.ServerConfig{BaseURL: "https://auth.example.com"}}
+
+	privateKey, jwk := dpopTestKey(t)
+	wantJKT, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint() error = %v", err)
+	}
+
+	const accessToken = "access-token"
+	sum := sha256.Sum256([]byte(accessToken))
+	ath := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	jti := 0
+	validClaims := func() jwt.MapClaims {
+		jti++
+		return jwt.MapClaims{
+			"htm": http.MethodGet,
+			"htu": "https://auth.example.com/api/v0/oauth/userinfo",
+			"iat": time.Now().Unix(),
+			"jti": "proof-" + strconv.Itoa(jti),
+			"ath": ath,
+		}
+	}
+	validHeader := func() map[string]interface{} {
+		return map[string]interface{}{"typ": "dpop+jwt", "jwk": jwk}
+	}
+
+	verify := func(proof string) (string, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v0/oauth/userinfo", nil)
+		if proof != "" {
+			c.Request.Header.Set("DPoP", proof)
+		}
+		return verifyDPoPProof(c, accessToken)
+	}
+
+	t.Run("没有 DPoP 头", func(t *testing.T) {
+		if jkt, err := verify(""); jkt != "" || err != nil {
+			t.Errorf("verifyDPoPProof() = (%q, %v), want empty result", jkt, err)
+		}
+	})
+
+	t.Run("合法的证明只能使用一次", func(t *testing.T) {
+		proof := signDPoPProof(t, privateKey, validHeader(), validClaims())
+		jkt, err := verify(proof)
+		if err != nil || jkt != wantJKT {
+			t.Fatalf("verifyDPoPProof() = (%q, %v), want (%q, nil)", jkt, err, wantJKT)
+		}
+		if _, err := verify(proof); err == nil {
+			t.Error("verifyDPoPProof() accepted a replayed proof")
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		mutate func(header map[string]interface{}, claims jwt.MapClaims)
+	}{
+		{"typ 不正确", func(h map[string]interface{}, _ jwt.MapClaims) { h["typ"] = "JWT" }},
+		{"缺少 jwk", func(h map[string]interface{}, _ jwt.MapClaims) { delete(h, "jwk") }},
+		{"jwk 包含私钥", func(h map[string]interface{}, _ jwt.MapClaims) {
+			h["jwk"] = map[string]interface{}{"kty": "EC", "crv": "P-256", "x": jwk.X, "y": jwk.Y, "d": "secret"}
+		}},
+		{"htm 不匹配", func(_ map[string]interface{}, c jwt.MapClaims) { c["htm"] = http.MethodPost }},
+		{"htu 不匹配", func(_ map[string]interface{}, c jwt.MapClaims) {
+			c["htu"] = "https://auth.example.com/api/v0/oauth/token"
+		}},
+		{"iat 过早", func(_ map[string]interface{}, c jwt.MapClaims) { c["iat"] = time.Now().Add(-time.Hour).Unix() }},
+		{"iat 在未来", func(_ map[string]interface{}, c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"缺少 jti", func(_ map[string]interface{}, c jwt.MapClaims) { delete(c, "jti") }},
+		{"ath 不匹配", func(_ map[string]interface{}, c jwt.MapClaims) { c["ath"] = "other" }},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			header, claims := validHeader(), validClaims()
+			tt.mutate(header, claims)
+			if _, err := verify(signDPoPProof(t, privateKey, header, claims)); err == nil {
+				t.Error("verifyDPoPProof() error = nil, want an error")
+			}
+		})
+	}
+
+	t.Run("签名与 jwk 不匹配", func(t *testing.T) {
+		otherKey, _ := dpopTestKey(t)
+		if _, err := verify(signDPoPProof(t, otherKey, validHeader(), validClaims())); err == nil {
+			t.Error("verifyDPoPProof() error = nil, want an error")
+		}
+	})
+}
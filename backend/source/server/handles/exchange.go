@@ -0,0 +1,205 @@
+package handles
+
+import (
+	"fmt"
+	"net/http"
+	"nyauth_backed/source"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 可以交换与签发的令牌类型，两者都对应本服务签发的访问令牌
+var exchangeTokenTypes = []string{oauth.TokenTypeAccessToken, oauth.TokenTypeJWT}
+
+// tokenExchangeGrant 处理 grant_type=urn:ietf:params:oauth:grant-type:token-exchange (RFC 8693)
+// 客户端可以将收到的访问令牌兑换为受众不同、权限范围更小或以用户某个多身份签发的令牌
+func tokenExchangeGrant(c *gin.Context, client *models.DatabaseClient) {
+	// 公开客户端无法证明自己的身份
+	if client.PublicClient {
+		SendOAuthError(c, http.StatusBadRequest, "unauthorized_client", "public clients cannot use token exchange")
+		return
+	}
+
+	subjectToken := c.PostForm("subject_token")
+	subjectTokenType := c.PostForm("subject_token_type")
+	if subjectToken == "" || subjectTokenType == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "subject_token and subject_token_type are required")
+		return
+	}
+	if !slices.Contains(exchangeTokenTypes, subjectTokenType) {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "unsupported subject_token_type")
+		return
+	}
+
+	requestedTokenType := c.PostForm("requested_token_type")
+	if requestedTokenType != "" && !slices.Contains(exchangeTokenTypes, requestedTokenType) {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "unsupported requested_token_type")
+		return
+	}
+
+	// audience 与 resource 都按资源标识处理，同时提供时以 resource 为准
+	resource := c.PostForm("resource")
+	if resource == "" {
+		resource = c.PostForm("audience")
+	}
+	audience, format, ok := accessTokenTarget(c, client, resource)
+	if !ok {
+		return
+	}
+	issuedTokenType := oauth.TokenTypeAccessToken
+	if requestedTokenType == oauth.TokenTypeJWT {
+		format = oauth.TokenFormatJWT
+		issuedTokenType = oauth.TokenTypeJWT
+	}
+
+	clientID := client.ID.Hex()
+
+	subject, exists := oauth.GetToken(subjectToken)
+	if !exists {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "subject_token is invalid or expired")
+		return
+	}
+	if !clientMayExchange(clientID, subject) {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "the client is not allowed to exchange this subject_token")
+		return
+	}
+
+	// 提供 actor_token 时为委托，新令牌的 act 声明记录行为方，被交换令牌已有的 act 作为前序行为方
+	act := subject.Act
+	actorToken := c.PostForm("actor_token")
+	actorTokenType := c.PostForm("actor_token_type")
+	if actorToken != "" {
+		if !slices.Contains(exchangeTokenTypes, actorTokenType) {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_request", "actor_token_type is missing or unsupported")
+			return
+		}
+		// 行为方令牌必须签发给发起交换的客户端，防止冒用其他服务的身份
+		actor, exists := oauth.GetToken(actorToken)
+		if !exists || actor.ClientID != clientID {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_request", "actor_token is invalid or not issued to this client")
+			return
+		}
+		act = oauth.NewActClaim(actor.Subject(), subject.Act)
+	} else if actorTokenType != "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "actor_token_type must not be sent without actor_token")
+		return
+	}
+
+	// 可以申请比被交换令牌更小的权限范围，但不能扩大，且必须在客户端的权限之内
+	scope := subject.Scope
+	if requested := oauth.ParseScope(c.PostForm("scope")); len(requested) > 0 {
+		for _, s := range requested {
+			if !oauth.ContainsScope(subject.Scope, s) {
+				SendOAuthError(c, http.StatusBadRequest, "invalid_scope", "requested scope exceeds the subject_token")
+				return
+			}
+		}
+		scope = requested
+	}
+	scope, invalid := oauth.GrantScope(scope, client.Permissions)
+	if len(invalid) > 0 {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_scope", "scope not allowed for this client: "+strings.Join(invalid, " "))
+		return
+	}
+
+	// 兑换为用户的多身份时，身份必须属于该用户，已经代表某个身份的令牌不能再切换身份
+	// 用户必须已在授权页面以该身份授权过发起交换的客户端，否则应用可以借此关联主账号与身份
+	identityID := subject.IdentityID
+	if requested := c.PostForm("identity_id"); requested != "" && requested != identityID {
+		if subject.UserID == "" || subject.IdentityID != "" {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_request", "subject_token cannot be exchanged for an identity")
+			return
+		}
+
+		identity, err := database.GetIdentityByID(requested)
+		if err != nil {
+			sendServerError(c)
+			fmt.Printf("GetIdentityByID err: %s\n", err.Error())
+			return
+		}
+		if identity == nil || identity.Attributed != subject.UserID {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_request", "identity_id does not belong to the subject")
+			return
+		}
+
+		authorization, err := database.GetAuthorization(subject.UserID, clientID)
+		if err != nil {
+			sendServerError(c)
+			fmt.Printf("GetAuthorization err: %s\n", err.Error())
+			return
+		}
+		if authorization == nil || authorization.IdentityID != requested {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "the user has not authorized this client with the requested identity")
+			return
+		}
+		identityID = requested
+	}
+
+	// 新令牌不能比被交换的令牌存活更久
+	expiresIn := min(int(time.Until(subject.Exp).Seconds()), oauth.DefaultTokenExpiresIn)
+	if expiresIn <= 0 {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "subject_token is invalid or expired")
+		return
+	}
+
+	// 新令牌签发给发起交换的客户端，sub 按该客户端的主体标识类型重新计算
+	var clientSub string
+	if subject.UserID != "" {
+		var err error
+		clientSub, err = clientSubject(client, subject.UserID, identityID)
+		if err != nil {
+			sendServerError(c)
+			fmt.Printf("clientSubject err: %s\n", err.Error())
+			return
+		}
+	}
+
+	// 沿用被交换令牌的令牌族，原令牌族被吊销或用户撤销对原应用的授权时一并失效
+	accessToken, err := oauth.CreateToken(oauth.Token{
+		ClientID:   clientID,
+		UserID:     subject.UserID,
+		IdentityID: identityID,
+		ClientSub:  clientSub,
+		Scope:      scope,
+		FamilyID:   subject.FamilyID,
+		Audience:   audience,
+		Format:     format,
+		JKT:        dpopJKT(c),
+		Act:        act,
+	}, expiresIn)
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("CreateToken err: %s\n", err.Error())
+		return
+	}
+
+	tokenObj, exists := oauth.GetToken(accessToken)
+	if !exists {
+		sendServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":      accessToken,
+		"issued_token_type": issuedTokenType,
+		"token_type":        tokenObj.TokenType(),
+		"expires_in":        int(time.Until(tokenObj.Exp).Seconds()),
+		"scope":             strings.Join(tokenObj.Scope, " "),
+	})
+}
+
+// clientMayExchange 检查客户端是否可以交换该令牌
+// 令牌签发给客户端本身，或令牌的受众是客户端作为资源服务器登记的资源时允许交换
+func clientMayExchange(clientID string, subject *oauth.Token) bool {
+	if subject.ClientID == clientID {
+		return true
+	}
+	resource := source.AppConfig.OAuth.FindResource(subject.Audience)
+	return resource != nil && slices.Contains(resource.ExchangeClients, clientID)
+}
@@ -0,0 +1,121 @@
+package handles
+
+import (
+	"net/http"
+	"nyauth_backed/source"
+	"nyauth_backed/source/oauth"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthIntrospect 令牌自省端点 (RFC 7662)，供资源服务器校验访问令牌与刷新令牌
+func OAuthIntrospect(c *gin.Context) {
+	token := c.PostForm("token")
+	tokenTypeHint := c.PostForm("token_type_hint")
+
+	if token == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	client, ok := authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	// 自省端点只对能证明自己身份的客户端开放
+	if client.PublicClient {
+		SendOAuthError(c, http.StatusUnauthorized, "invalid_client", "public clients cannot use the introspection endpoint")
+		return
+	}
+
+	// 按 token_type_hint 决定查找顺序，找不到时再尝试另一种令牌
+	clientID := client.ID.Hex()
+	var result gin.H
+	if tokenTypeHint == "refresh_token" {
+		result = introspectRefreshToken(clientID, token)
+		if result == nil {
+			result = introspectAccessToken(clientID, token)
+		}
+	} else {
+		result = introspectAccessToken(clientID, token)
+		if result == nil {
+			result = introspectRefreshToken(clientID, token)
+		}
+	}
+
+	// 无效、过期、不存在或无权查看的令牌统一返回 active=false，不透露更多信息
+	if result == nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// introspectAccessToken 构造访问令牌的自省结果，令牌无效或调用方无权查看时返回 nil
+// 自省是资源服务器与本服务之间的可信调用，不校验 DPoP 证明
+// DPoP 绑定的令牌总是返回 cnf.jkt，由资源服务器比对客户端请求中的 DPoP 证明
+func introspectAccessToken(clientID, token string) gin.H {
+	tokenObj, exists := oauth.GetToken(token)
+	if !exists || !clientMayIntrospect(clientID, tokenObj) {
+		return nil
+	}
+
+	result := gin.H{
+		"active":     true,
+		"scope":      strings.Join(tokenObj.Scope, " "),
+		"client_id":  tokenObj.ClientID,
+		"exp":        tokenObj.Exp.Unix(),
+		"iat":        tokenObj.IssuedAt.Unix(),
+		"token_type": tokenObj.TokenType(),
+	}
+	// client_credentials 签发的令牌没有关联用户
+	if tokenObj.UserID != "" {
+		result["sub"] = tokenObj.Subject()
+	}
+	if tokenObj.Audience != "" {
+		result["aud"] = tokenObj.Audience
+	}
+	if tokenObj.JTI != "" {
+		result["jti"] = tokenObj.JTI
+	}
+	if tokenObj.Act != nil {
+		result["act"] = tokenObj.Act
+	}
+	// 资源服务器需要比对请求中 DPoP 证明的公钥指纹 (RFC 9449 §6.2)
+	if tokenObj.JKT != "" {
+		result["cnf"] = gin.H{"jkt": tokenObj.JKT}
+	}
+	return result
+}
+
+// introspectRefreshToken 构造刷新令牌的自省结果，令牌无效或不是签发给调用方的令牌时返回 nil
+func introspectRefreshToken(clientID, token string) gin.H {
+	refreshToken, exists := oauth.GetRefreshToken(token)
+	if !exists || refreshToken.ClientID != clientID {
+		return nil
+	}
+
+	return gin.H{
+		"active":     true,
+		"scope":      strings.Join(refreshToken.Scope, " "),
+		"client_id":  refreshToken.ClientID,
+		"sub":        refreshToken.Subject(),
+		"exp":        refreshToken.Exp.Unix(),
+		"iat":        refreshToken.IssuedAt.Unix(),
+		"token_type": "refresh_token",
+	}
+}
+
+// clientMayIntrospect 检查客户端是否可以查看访问令牌的自省结果
+// 令牌签发给客户端本身，或令牌的受众是客户端作为资源服务器登记的资源时允许查看
+func clientMayIntrospect(clientID string, tokenObj *oauth.Token) bool {
+	if tokenObj.ClientID == clientID {
+		return true
+	}
+	resource := source.AppConfig.OAuth.FindResource(tokenObj.Audience)
+	return resource != nil && slices.Contains(resource.IntrospectClients, clientID)
+}
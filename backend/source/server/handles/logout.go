@@ -0,0 +1,177 @@
+package handles
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"nyauth_backed/source"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/logger"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"nyauth_backed/source/untils"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 发送后端登出通知使用的 HTTP 客户端，应用无响应时不能一直等待
+// 不跟随重定向，且只连接公网地址，避免通过重定向或域名解析请求服务器所在网络的内部服务
+var backchannelLogoutClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublicAddressOnly}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// dialPublicAddressOnly 拒绝连接非公网地址
+func dialPublicAddressOnly(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !oauth.IsPublicIP(ip) {
+		return errors.New("refusing to connect to non-public address " + host)
+	}
+	return nil
+}
+
+// EndSession 处理 OIDC RP-Initiated Logout，结束用户当前的登录会话并通知会话中授权过的应用
+// 前端登出页面调用该接口，未登录时同样可以调用，此时只校验并返回跳转地址
+// 返回需要由浏览器加载的前端登出地址，以及登出完成后跳转回应用的地址
+func EndSession(c *gin.Context) {
+	var req models.EndSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		SendResponse(c, http.StatusBadRequest, "请求参数错误", nil)
+		return
+	}
+
+	// id_token_hint 标识发起登出的应用，允许使用已过期的 ID 令牌
+	clientID := req.ClientID
+	if req.IDTokenHint != "" {
+		claims, err := helper.JwtHelper.ParseIDToken(req.IDTokenHint)
+		if err != nil {
+			SendResponse(c, http.StatusBadRequest, "id_token_hint 无效", nil)
+			return
+		}
+		audience, err := claims.GetAudience()
+		if err != nil || len(audience) != 1 {
+			SendResponse(c, http.StatusBadRequest, "id_token_hint 无效", nil)
+			return
+		}
+		if clientID != "" && clientID != audience[0] {
+			SendResponse(c, http.StatusBadRequest, "client_id 与 id_token_hint 不匹配", nil)
+			return
+		}
+		clientID = audience[0]
+	}
+
+	// 登出后只能跳转到应用注册过的地址
+	redirectURL := ""
+	if req.PostLogoutRedirectURI != "" {
+		if clientID == "" {
+			SendResponse(c, http.StatusBadRequest, "使用 post_logout_redirect_uri 时必须提供 id_token_hint 或 client_id", nil)
+			return
+		}
+
+		client, err := database.GetClientByClientID(clientID)
+		if err != nil {
+			SendResponse(c, http.StatusInternalServerError, "服务器错误，无法验证客户端信息", nil)
+			fmt.Printf("GetClientByClientID err: %s\n", err.Error())
+			return
+		}
+		if client == nil {
+			SendResponse(c, http.StatusNotFound, "未找到指定的应用", nil)
+			return
+		}
+		if !slices.Contains(client.PostLogoutRedirectURIs, req.PostLogoutRedirectURI) {
+			SendResponse(c, http.StatusBadRequest, "提供的 post_logout_redirect_uri 不匹配", nil)
+			return
+		}
+
+		redirectURL = req.PostLogoutRedirectURI
+		if req.State != "" {
+			redirectURL = buildRedirectURL(redirectURL, url.Values{"state": {req.State}})
+		}
+	}
+
+	// 结束当前登录会话，旧版没有会话ID的门户 JWT 只能由前端清除
+	frontchannelLogoutURIs := []string{}
+	if token, err := helper.JwtHelper.VerifyToken(bearerToken(c), "user"); err == nil {
+		if sessionID, sessionExp := sessionClaims(token.Claims); sessionID != "" {
+			if session := oauth.EndSession(sessionID, sessionExp); session != nil {
+				frontchannelLogoutURIs = notifySessionClients(session)
+			}
+		}
+	}
+
+	SendResponse(c, http.StatusOK, "已退出登录", gin.H{
+		"redirect_url":             redirectURL,
+		"frontchannel_logout_uris": frontchannelLogoutURIs,
+	})
+}
+
+// notifySessionClients 向会话中授权过的应用发送后端登出通知，并返回需要由浏览器加载的前端登出地址
+func notifySessionClients(session *oauth.Session) []string {
+	issuer := source.AppConfig.Server.BaseURL
+	frontchannelLogoutURIs := []string{}
+
+	for clientID, subject := range session.Clients {
+		client, err := database.GetClientByClientID(clientID)
+		if err != nil {
+			fmt.Printf("GetClientByClientID err: %s\n", err.Error())
+			continue
+		}
+		if client == nil {
+			continue
+		}
+
+		if client.BackchannelLogoutURI != "" {
+			go sendBackchannelLogout(client.BackchannelLogoutURI, subject, clientID, session.SessionID)
+		}
+
+		if client.FrontchannelLogoutURI != "" {
+			uri := client.FrontchannelLogoutURI
+			if client.FrontchannelLogoutSessionRequired {
+				uri = buildRedirectURL(uri, url.Values{"iss": {issuer}, "sid": {session.SessionID}})
+			}
+			frontchannelLogoutURIs = append(frontchannelLogoutURIs, uri)
+		}
+	}
+
+	return frontchannelLogoutURIs
+}
+
+// sendBackchannelLogout 向应用的后端登出地址发送登出令牌 (OIDC Back-Channel Logout §2.5)
+func sendBackchannelLogout(uri, subject, clientID, sessionID string) {
+	jti, err := untils.GenerateRandomCode(32, false)
+	if err != nil {
+		fmt.Printf("GenerateRandomCode err: %s\n", err.Error())
+		return
+	}
+
+	logoutToken, err := helper.JwtHelper.IssueLogoutToken(subject, clientID, sessionID, jti)
+	if err != nil {
+		fmt.Printf("IssueLogoutToken err: %s\n", err.Error())
+		return
+	}
+
+	resp, err := backchannelLogoutClient.PostForm(uri, url.Values{"logout_token": {logoutToken}})
+	if err != nil {
+		logger.Warning("Back-channel logout to client %s failed: %s", clientID, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Warning("Back-channel logout to client %s returned status %d", clientID, resp.StatusCode)
+	}
+}
@@ -3,38 +3,107 @@ package handles
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"nyauth_backed/source/database"
-	"nyauth_backed/source/helper"
 	"nyauth_backed/source/models"
 	"nyauth_backed/source/oauth"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// authorizeRequest 授权请求参数
+type authorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               []string
+	State               string // 可选参数，用于防止CSRF攻击
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              []string // 空格分隔的 prompt 取值
+	MaxAge              string   // 允许的最长登录时间（秒），为空时不限制
+	LoginHint           string   // 建议登录的账号，用户名或邮箱
+	IDTokenHint         string   // 此前签发给应用的 ID 令牌，标识期望的用户
+	IdentityID          string   // 用户在授权页面选择的多身份ID，为空或为用户ID时代表用户本身
+	LoginState          string   // 要求重新登录时签发的 login_state，用户登录后由前端带回
+}
+
+// authorizeError 授权请求校验失败的原因
+type authorizeError struct {
+	Code        string // OAuth 错误码
+	Description string // 返回给应用的 error_description
+	Msg         string // 展示给用户的提示
+}
+
+// parseAuthorizeRequest 从请求参数中读取授权请求
+func parseAuthorizeRequest(params url.Values) *authorizeRequest {
+	return &authorizeRequest{
+		ClientID:            params.Get("client_id"),
+		RedirectURI:         params.Get("redirect_uri"),
+		ResponseType:        params.Get("response_type"),
+		Scope:               oauth.ParseScope(params.Get("scope")),
+		State:               params.Get("state"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+		Prompt:              strings.Fields(params.Get("prompt")),
+		MaxAge:              params.Get("max_age"),
+		LoginHint:           params.Get("login_hint"),
+		IDTokenHint:         params.Get("id_token_hint"),
+	}
+}
+
+// validateAuthorizeRequest 校验重定向URI以外的授权请求参数，授权端点与 PAR 端点共用
+func validateAuthorizeRequest(client *models.DatabaseClient, req *authorizeRequest) *authorizeError {
+	// 验证response_type，目前只支持code模式
+	if req.ResponseType != "code" {
+		return &authorizeError{"unsupported_response_type", "only response_type=code is supported", "不支持的 response_type"}
+	}
+
+	// 校验 PKCE 参数，公开客户端必须使用 PKCE
+	if req.CodeChallenge != "" {
+		if req.CodeChallengeMethod == "" {
+			req.CodeChallengeMethod = oauth.CodeChallengeMethodPlain
+		}
+		if !oauth.IsSupportedCodeChallengeMethod(req.CodeChallengeMethod) {
+			return &authorizeError{"invalid_request", "unsupported code_challenge_method", "不支持的 code_challenge_method"}
+		}
+		if !oauth.IsValidCodeChallenge(req.CodeChallenge) {
+			return &authorizeError{"invalid_request", "malformed code_challenge", "code_challenge 格式不正确"}
+		}
+	} else if client.PublicClient {
+		return &authorizeError{"invalid_request", "public clients must use PKCE", "公开客户端必须提供 code_challenge"}
+	}
+
+	// 检查scope中是否包含openid
+	if !oauth.ContainsScope(req.Scope, "openid") {
+		return &authorizeError{"invalid_scope", "the openid scope is required", "缺少必要的 openid 权限范围"}
+	}
+
+	// 请求的权限范围必须都在应用的权限之内
+	if _, invalid := oauth.GrantScope(req.Scope, client.Permissions); len(invalid) > 0 {
+		return &authorizeError{"invalid_scope", "scope not allowed for this client: " + strings.Join(invalid, " "), "请求的权限范围无效"}
+	}
+
+	return validatePrompt(req)
+}
+
+// OAuthAuthorize 授权端点，用户在前端确认授权后附带 approved=true 调用，返回带有授权码的重定向地址
+// 前端跳过确认页面时不附带 approved，由后端检查此前的授权是否仍然有效
+// 重定向URI验证通过之前的错误直接返回给前端，之后的错误按 RFC 6749 §4.1.2.1 带回应用的重定向URI
 func OAuthAuthorize(c *gin.Context) {
 	// 从请求中获取OAuth参数
-	clientID := c.Query("client_id")
-	redirectURI := c.Query("redirect_uri")
-	responseType := c.Query("response_type")
-	scope := c.Query("scope")
-	state := c.Query("state") // 可选参数，用于防止CSRF攻击
+	params := c.Request.URL.Query()
+	clientID := params.Get("client_id")
 
 	// 验证必要参数
-	if clientID == "" || redirectURI == "" || responseType == "" {
+	if clientID == "" {
 		SendResponse(c, http.StatusBadRequest, "参数不完整", nil)
 		return
 	}
 
-	// 验证response_type，目前只支持code模式
-	if responseType != "code" {
-		SendResponse(c, http.StatusBadRequest, "不支持的 response_type", nil)
-		return
-	}
-
 	// 获取客户端信息
 	client, err := database.GetClientByClientID(clientID)
 	if err != nil {
@@ -48,15 +117,109 @@ func OAuthAuthorize(c *gin.Context) {
 		return
 	}
 
+	if client.Status == models.ClientStatusDisabled {
+		SendResponse(c, http.StatusForbidden, "该应用已被停用", nil)
+		return
+	}
+
+	// 使用 PAR 时，授权参数全部来自客户端事先推送的请求 (RFC 9126 §4)
+	// 推送的请求中的请求对象已在 PAR 端点验证过
+	// 用户可能需要重新登录后再次提交，签发授权码或将错误带回应用时 request_uri 才失效
+	requestURI := params.Get("request_uri")
+	pushed := false
+	signed := false
+	var replay *requestObjectReplay
+	if requestURI != "" && !params.Has("request") {
+		pushedParams, exists := oauth.GetPushedRequest(requestURI, clientID)
+		if !exists {
+			SendResponse(c, http.StatusBadRequest, "request_uri 无效或已过期", nil)
+			return
+		}
+		params = pushedParams
+		pushed = true
+	} else if params.Has("request") {
+		// 只使用请求对象中的参数 (RFC 9101)，验证失败时无法信任其中的 redirect_uri
+		// 用户重新登录后会再次提交同一请求对象，签发授权码时才记录其 jti
+		params, replay, err = resolveRequestObject(client, params)
+		if err != nil {
+			SendResponse(c, http.StatusBadRequest, "request 参数无效", gin.H{"error": "invalid_request_object"})
+			fmt.Printf("resolveRequestObject err: %s\n", err.Error())
+			return
+		}
+		signed = true
+	}
+
+	req := parseAuthorizeRequest(params)
+	req.ClientID = clientID
+	// 身份由用户在授权页面选择，不来自应用推送或签名的请求
+	req.IdentityID = c.Query("identity_id")
+	req.LoginState = c.Query("login_state")
+
+	if req.RedirectURI == "" {
+		SendResponse(c, http.StatusBadRequest, "参数不完整", nil)
+		return
+	}
+
 	// 验证重定向URI是否与注册的一致
-	if client.RedirectURI != redirectURI {
+	if !oauth.MatchRedirectURI(clientRedirectURIs(client), req.RedirectURI) {
 		SendResponse(c, http.StatusBadRequest, "提供的 redirect_uri 不匹配", nil)
 		return
 	}
 
-	// 检查scope中是否包含openid
-	if scope == "" || !strings.Contains(scope, "openid") {
-		SendResponse(c, http.StatusBadRequest, "缺少必要的 openid 权限范围", nil)
+	redirectURI := req.RedirectURI
+	state := req.State
+
+	// 错误带回应用后授权请求已经结束，推送的请求随之失效
+	redirectError := func(errCode, description, msg string) {
+		if pushed {
+			oauth.ConsumePushedRequest(requestURI, clientID)
+		}
+		sendAuthorizeError(c, redirectURI, state, errCode, description, msg)
+	}
+
+	if client.RequirePushedAuthorizationRequests && !pushed {
+		redirectError("invalid_request", "this client must use pushed authorization requests", "该应用要求使用 PAR 提交授权请求")
+		return
+	}
+
+	// 要求签名请求的应用，未使用 PAR 时必须提交请求对象，使用 PAR 时已在 PAR 端点检查
+	if client.RequireSignedRequestObject && !pushed && !signed {
+		redirectError("invalid_request", "this client must use a signed request object", "该应用要求使用签名的请求对象")
+		return
+	}
+
+	if authErr := validateAuthorizeRequest(client, req); authErr != nil {
+		redirectError(authErr.Code, authErr.Description, authErr.Msg)
+		return
+	}
+
+	// 未选择身份时沿用此前授权时选择的身份，自动授权与 prompt=none 不经过身份选择页面
+	if !c.Request.URL.Query().Has("identity_id") {
+		if err := fillStoredIdentity(c, req); err != nil {
+			redirectError("server_error", "", "获取授权记录失败")
+			fmt.Printf("GetAuthorization err: %s\n", err.Error())
+			return
+		}
+	}
+
+	// 需要重新登录时，prompt=none 直接带回错误，否则由前端清除登录状态并跳转到登录页面
+	if authErr := checkAuthentication(c, client, req); authErr != nil {
+		if authErr.Code == "login_required" && !req.hasPrompt("none") {
+			// 记录要求重新登录的时间，用户在此之后登录才能继续授权
+			loginState, err := oauth.CreateLoginRequest(clientID)
+			if err != nil {
+				redirectError("server_error", "", "生成登录状态失败")
+				fmt.Printf("CreateLoginRequest err: %s\n", err.Error())
+				return
+			}
+			SendResponse(c, http.StatusUnauthorized, authErr.Msg, gin.H{
+				"login_required": true,
+				"login_hint":     req.LoginHint,
+				"login_state":    loginState,
+			})
+			return
+		}
+		redirectError(authErr.Code, authErr.Description, authErr.Msg)
 		return
 	}
 
@@ -69,34 +232,172 @@ func OAuthAuthorize(c *gin.Context) {
 
 	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
 
+	identityID, authErr := authorizeIdentity(userID, req.IdentityID)
+	if authErr != nil {
+		redirectError(authErr.Code, authErr.Description, authErr.Msg)
+		return
+	}
+
+	// 用户未在确认页面同意时，此前的授权必须使用同一身份并已覆盖请求的权限范围
+	// prompt=consent 时必须由用户再次确认，prompt=none 时无法向用户确认
+	approved := c.Query("approved") == "true" && !req.hasPrompt("none")
+	if !approved {
+		authorization, err := database.GetAuthorization(userID, clientID)
+		if err != nil {
+			redirectError("server_error", "", "获取授权记录失败")
+			fmt.Printf("GetAuthorization err: %s\n", err.Error())
+			return
+		}
+		if req.hasPrompt("consent") || authorization == nil || authorization.IdentityID != identityID || !oauth.CoversScope(authorization.Scope, req.Scope) {
+			if req.hasPrompt("none") {
+				redirectError("consent_required", "the user has not granted the requested scope", "需要用户确认授权")
+				return
+			}
+			// 由前端展示确认页面，用户同意后再次提交
+			SendResponse(c, http.StatusForbidden, "需要用户确认授权", gin.H{
+				"consent_required": true,
+			})
+			return
+		}
+	}
+
+	// 记录用户同意的权限范围与所选身份，之后相同身份、相同或更小范围的授权请求无需再次确认
+	if err := database.SaveAuthorization(userID, clientID, identityID, req.Scope); err != nil {
+		redirectError("server_error", "", "保存授权记录失败")
+		fmt.Printf("SaveAuthorization err: %s\n", err.Error())
+		return
+	}
+
+	// 登出令牌中的 sub 必须与签发给应用的ID令牌一致
+	subject, err := clientSubject(client, userID, identityID)
+	if err != nil {
+		redirectError("server_error", "", "获取用户标识失败")
+		fmt.Printf("clientSubject err: %s\n", err.Error())
+		return
+	}
+
+	// 请求对象只能用于一次授权
+	if !replay.markUsed() {
+		redirectError("invalid_request_object", "request object has already been used", "request 参数已被使用")
+		return
+	}
+
+	// request_uri 只能用于一次授权
+	if pushed {
+		if _, exists := oauth.ConsumePushedRequest(requestURI, clientID); !exists {
+			redirectError("invalid_request", "request_uri has already been used", "request_uri 无效或已过期")
+			return
+		}
+	}
+
 	// 生成授权码
-	authCode, err := oauth.CreateAuthorizationCode(clientID, userID)
+	sessionID, sessionExp := portalSession(c)
+	authCode, err := oauth.CreateAuthorizationCode(oauth.AuthorizationCode{
+		ClientID:            clientID,
+		UserID:              userID,
+		IdentityID:          identityID,
+		RedirectURI:         redirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		SessionID:           sessionID,
+		AuthTime:            portalAuthTime(claims.(jwt.MapClaims)),
+	})
 	if err != nil {
-		SendResponse(c, http.StatusInternalServerError, "生成授权码失败", nil)
+		redirectError("server_error", "", "生成授权码失败")
 		fmt.Printf("CreateAuthorizationCode err: %s\n", err.Error())
 		return
 	}
 
-	// 构建重定向URL
-	var redirectURL string
-	if strings.Contains(redirectURI, "?") {
-		// 如果重定向URI已经包含查询参数，使用&连接
-		redirectURL = fmt.Sprintf("%s&code=%s", redirectURI, authCode)
-	} else {
-		// 否则使用?开始查询参数
-		redirectURL = fmt.Sprintf("%s?code=%s", redirectURI, authCode)
+	// login_state 只能用于一次授权
+	if req.LoginState != "" {
+		oauth.DeleteLoginRequest(req.LoginState)
 	}
 
+	// 记录会话中授权过的应用，用户登出时通知该应用
+	oauth.AddSessionClient(sessionID, userID, clientID, subject, sessionExp)
+
+	// 构建重定向URL
+	response := url.Values{}
+	response.Set("code", authCode)
 	if state != "" {
-		redirectURL = fmt.Sprintf("%s&state=%s", redirectURL, state)
+		response.Set("state", state)
 	}
 
 	// 返回URL给前端，由前端进行跳转，而不是直接重定向
 	SendResponse(c, http.StatusOK, "授权成功", gin.H{
-		"redirect_url": redirectURL,
+		"redirect_url": buildRedirectURL(redirectURI, response),
+	})
+}
+
+// authorizeIdentity 校验用户选择的多身份，返回授权使用的身份ID
+// 身份必须属于当前用户，未选择或选择主账号时返回空字符串
+func authorizeIdentity(userID, identityID string) (string, *authorizeError) {
+	if identityID == "" || identityID == userID {
+		return "", nil
+	}
+
+	identity, err := database.GetIdentityByID(identityID)
+	if err != nil || identity == nil || identity.Attributed != userID {
+		if err != nil {
+			fmt.Printf("GetIdentityByID err: %s\n", err.Error())
+		}
+		return "", &authorizeError{"invalid_request", "identity_id does not belong to the user", "所选身份无效"}
+	}
+	return identityID, nil
+}
+
+// fillStoredIdentity 授权请求未选择身份时，使用用户此前授权该应用时选择的身份
+// 未登录时不做处理，由 checkAuthentication 要求登录
+func fillStoredIdentity(c *gin.Context, req *authorizeRequest) error {
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		return nil
+	}
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
+
+	authorization, err := database.GetAuthorization(userID, req.ClientID)
+	if err != nil {
+		return err
+	}
+	if authorization != nil {
+		req.IdentityID = authorization.IdentityID
+	}
+	return nil
+}
+
+// sendAuthorizeError 将授权错误附加到已验证的重定向URI上，由前端跳转回应用
+// msg 为展示给用户的提示，description 为返回给应用的 error_description
+func sendAuthorizeError(c *gin.Context, redirectURI, state, errCode, description, msg string) {
+	params := url.Values{}
+	params.Set("error", errCode)
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	status := http.StatusBadRequest
+	if errCode == "server_error" {
+		status = http.StatusInternalServerError
+	}
+
+	SendResponse(c, status, msg, gin.H{
+		"error":        errCode,
+		"redirect_url": buildRedirectURL(redirectURI, params),
 	})
 }
 
+// clientRedirectURIs 返回客户端注册的全部重定向URI，包括旧版的单个 redirect_uri
+func clientRedirectURIs(client *models.DatabaseClient) []string {
+	uris := client.RedirectURIs
+	if client.RedirectURI != "" {
+		uris = append([]string{client.RedirectURI}, uris...)
+	}
+	return uris
+}
+
 func GetClientinfo(c *gin.Context) {
 	// 从请求体中获取客户端ID
 	var creds models.GetClientinfoCredentials
@@ -126,11 +427,15 @@ func GetClientinfo(c *gin.Context) {
 		return
 	}
 
-	// 获取创建者的用户信息
-	creator, err := database.GetUserByID(client.CreatedBy)
-	if err != nil || creator == nil {
-		SendResponse(c, http.StatusNotFound, "啊嘞，怎么没有找到创建者?", nil)
-		return
+	// 获取创建者的用户信息，动态注册的应用没有创建者
+	var createdBy string
+	if client.CreatedBy != "" {
+		creator, err := database.GetUserByID(client.CreatedBy)
+		if err != nil || creator == nil {
+			SendResponse(c, http.StatusNotFound, "啊嘞，怎么没有找到创建者?", nil)
+			return
+		}
+		createdBy = creator.Username
 	}
 
 	// 构造返回数据，移除敏感信息
@@ -138,99 +443,74 @@ func GetClientinfo(c *gin.Context) {
 		"client_id":   client.ID.Hex(),
 		"client_name": client.ClientName,
 		"description": client.Description,
-		"created_by":  creator.Username,
+		"created_by":  createdBy,
 		"avatar":      client.Avatar,
 		"status":      client.Status,
 		"created_at":  client.CreatedAt,
 		"permissions": client.Permissions,
 	}
 
-	SendResponse(c, http.StatusOK, "获取应用信息成功", clientInfo)
-}
-
-func OAuthToken(c *gin.Context) {
-	// 解析表单数据
-	grantType := c.PostForm("grant_type")
-	code := c.PostForm("code")
-	clientID := c.PostForm("client_id")
-	clientSecret := c.PostForm("client_secret")
-	redirectURI := c.PostForm("redirect_uri")
-	nonce := c.PostForm("nonce")
-
-	// 验证必要参数
-	if grantType == "" || code == "" || clientID == "" || clientSecret == "" || redirectURI == "" {
-		SendResponse(c, http.StatusBadRequest, "参数不完整", nil)
-		return
+	// 使用 PAR 时授权参数保存在推送的请求中
+	params := url.Values{}
+	params.Set("scope", creds.Scope)
+	params.Set("prompt", creds.Prompt)
+	params.Set("max_age", creds.MaxAge)
+	params.Set("login_hint", creds.LoginHint)
+	params.Set("id_token_hint", creds.IDTokenHint)
+	if creds.RequestURI != "" {
+		if pushedParams, exists := oauth.GetPushedRequest(creds.RequestURI, creds.ClientID); exists {
+			params = pushedParams
+		}
 	}
+	req := parseAuthorizeRequest(params)
+	req.ClientID = client.ID.Hex()
+	req.LoginState = creds.LoginState
 
-	// 验证授权类型，目前只支持authorization_code
-	if grantType != "authorization_code" {
-		SendResponse(c, http.StatusBadRequest, "不支持的 grant_type", nil)
-		return
-	}
+	claims, _ := c.Get("jwtClaims")
+	userID := claims.(jwt.MapClaims)["data"].(map[string]interface{})["user_id"].(string)
 
-	// 验证客户端信息
-	client, err := database.GetClientByClientID(clientID)
+	// 返回此前授权时选择的身份，前端默认选中该身份
+	authorization, err := database.GetAuthorization(userID, client.ID.Hex())
 	if err != nil {
-		SendResponse(c, http.StatusInternalServerError, "无法验证客户端信息，等一下再试吧~", nil)
-		fmt.Printf("GetClientByClientID err: %s\n", err.Error())
-		return
-	}
-
-	if client == nil {
-		SendResponse(c, http.StatusNotFound, "没有这个 client 哦", nil)
-		return
-	}
-
-	// 验证客户端密钥
-	if client.ClientSecret != clientSecret {
-		SendResponse(c, http.StatusUnauthorized, "密钥不正确", nil)
-		return
-	}
-
-	// 验证重定向URI是否与注册的一致
-	fmt.Printf("RedirectURI: %s\n", redirectURI)
-	if client.RedirectURI != redirectURI {
-		SendResponse(c, http.StatusBadRequest, "提供的 redirect_uri 不匹配", nil)
-		return
-	}
-
-	// 验证授权码并获取相关信息
-	authInfo, valid := oauth.GetAuthorizationCode(code)
-	if !valid {
-		SendResponse(c, http.StatusBadRequest, "授权码无效或已过期", nil)
+		SendResponse(c, http.StatusInternalServerError, "不..不行❤里面坏掉了..❤", nil)
+		fmt.Printf("GetAuthorization err: %s\n", err.Error())
 		return
 	}
-
-	// 生成访问令牌
-	accessToken, err := oauth.CreateToken(clientID, authInfo.UserID, client.Permissions)
-	if err != nil {
-		SendResponse(c, http.StatusInternalServerError, "生成访问令牌失败", nil)
-		fmt.Printf("CreateToken err: %s\n", err.Error())
-		return
+	if authorization != nil {
+		req.IdentityID = authorization.IdentityID
+		clientInfo["identity_id"] = authorization.IdentityID
 	}
 
-	// 获取当前的token对象，以便返回过期时间
-	tokenObj, exists := oauth.GetToken(accessToken)
-	if !exists {
-		SendResponse(c, http.StatusInternalServerError, "获取令牌信息失败", nil)
-		return
+	// 当前登录不满足授权请求的要求时，前端需要先让用户重新登录
+	if authErr := checkAuthentication(c, client, req); authErr != nil && authErr.Code == "login_required" {
+		loginState, err := oauth.CreateLoginRequest(client.ID.Hex())
+		if err != nil {
+			SendResponse(c, http.StatusInternalServerError, "不..不行❤里面坏掉了..❤", nil)
+			fmt.Printf("CreateLoginRequest err: %s\n", err.Error())
+			return
+		}
+		clientInfo["login_required"] = true
+		clientInfo["login_state"] = loginState
 	}
 
-	idToken, err := helper.JwtHelper.IssueOIDCToken(authInfo.UserID, clientID, nonce, 6400)
-	if err != nil {
-		SendResponse(c, http.StatusInternalServerError, "生成ID令牌失败", nil)
-		fmt.Printf("IssueOIDCToken err: %s\n", err.Error())
-		return
+	// 用户此前的授权已覆盖请求的权限范围时，前端可以使用此前选择的身份跳过确认页面
+	// prompt=consent 或指定了其他身份时必须再次确认
+	if len(req.Scope) > 0 {
+		// 主账号的身份ID为用户ID，授权记录中保存为空字符串
+		identityChanged := false
+		if authorization != nil && creds.IdentityID != "" {
+			identityID := creds.IdentityID
+			if identityID == userID {
+				identityID = ""
+			}
+			identityChanged = identityID != authorization.IdentityID
+		}
+		clientInfo["consent_granted"] = authorization != nil &&
+			client.Status != models.ClientStatusDisabled &&
+			!req.hasPrompt("consent") &&
+			!identityChanged &&
+			oauth.CoversScope(authorization.Scope, req.Scope)
 	}
 
-	// 返回访问令牌
-	expiresIn := int(time.Until(tokenObj.Exp).Seconds())
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": accessToken,
-		"token_type":   "Bearer",
-		"expires_in":   expiresIn,
-		"scope":        tokenObj.Scope,
-		"id_token":     idToken,
-	})
+	SendResponse(c, http.StatusOK, "获取应用信息成功", clientInfo)
 }
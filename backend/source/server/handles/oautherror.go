@@ -0,0 +1,44 @@
+package handles
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SendOAuthError 按 RFC 6749 §5.2 返回 OAuth 错误，供第三方应用调用的端点使用
+// error_description 只允许 ASCII 字符，因此统一使用英文描述
+func SendOAuthError(c *gin.Context, status int, errCode string, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	body := gin.H{"error": errCode}
+	if description != "" {
+		body["error_description"] = description
+	}
+	c.JSON(status, body)
+}
+
+// sendInvalidClient 返回客户端认证失败，使用 HTTP Basic 认证的请求需带上 WWW-Authenticate 头
+func sendInvalidClient(c *gin.Context, description string) {
+	if strings.HasPrefix(c.GetHeader("Authorization"), "Basic ") {
+		c.Header("WWW-Authenticate", `Basic realm="Nyauth"`)
+	}
+	SendOAuthError(c, http.StatusUnauthorized, "invalid_client", description)
+}
+
+// sendServerError 返回服务器内部错误
+func sendServerError(c *gin.Context) {
+	SendOAuthError(c, http.StatusInternalServerError, "server_error", "the server encountered an unexpected error")
+}
+
+// buildRedirectURL 在重定向URI上追加查询参数，保留其原有的查询参数
+func buildRedirectURL(redirectURI string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + params.Encode()
+}
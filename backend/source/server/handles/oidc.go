@@ -2,11 +2,14 @@ package handles
 
 import (
 	"crypto/rsa"
+	"fmt"
 	"math/big"
 	"net/http"
 	"nyauth_backed/source"
+	"nyauth_backed/source/database"
 	"nyauth_backed/source/helper"
 	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
 	"nyauth_backed/source/untils"
 
 	"github.com/gin-gonic/gin"
@@ -27,26 +30,145 @@ type JWK struct {
 	E   string `json:"e"`
 }
 
+// 标准 OIDC 权限范围及与之等价的 Nyauth 权限
+var (
+	profileScopes = []string{"profile", "user:info"}
+	emailScopes   = []string{"email", "user:email"}
+)
+
 // GetOpenIDConfiguration 处理 /.well-known/openid-configuration 请求
 // 返回OpenID Connect提供者的配置信息
 func GetOpenIDConfiguration(c *gin.Context) {
 	baseURL := source.AppConfig.Server.BaseURL
 
 	config := models.OIDCConfiguration{
-		Issuer:                           baseURL,
-		AuthorizationEndpoint:            baseURL + "/oauth/authorize",
-		TokenEndpoint:                    baseURL + "/api/v0/oauth/token",
-		UserinfoEndpoint:                 baseURL + "/api/v0/account/info",
-		JwksURI:                          baseURL + "/.well-known/jwks.json",
-		ScopesSupported:                  []string{"openid", "profile", "email"},
-		ResponseTypesSupported:           []string{"code"},
-		SubjectTypesSupported:            []string{"public"},
-		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		Issuer:                                     baseURL,
+		AuthorizationEndpoint:                      baseURL + "/oauth/authorize",
+		TokenEndpoint:                              baseURL + "/api/v0/oauth/token",
+		UserinfoEndpoint:                           baseURL + "/api/v0/oauth/userinfo",
+		IntrospectionEndpoint:                      baseURL + "/api/v0/oauth/introspect",
+		RevocationEndpoint:                         baseURL + "/api/v0/oauth/revoke",
+		DeviceAuthorizationEndpoint:                baseURL + "/api/v0/oauth/device_authorization",
+		PushedAuthorizationRequestEndpoint:         baseURL + "/api/v0/oauth/par",
+		EndSessionEndpoint:                         baseURL + "/oauth/logout",
+		JwksURI:                                    baseURL + "/.well-known/jwks.json",
+		ScopesSupported:                            []string{"openid", "profile", "email", oauth.ScopeOfflineAccess},
+		ResponseTypesSupported:                     []string{"code"},
+		GrantTypesSupported:                        []string{"authorization_code", "refresh_token", "client_credentials", oauth.GrantTypeDeviceCode, oauth.GrantTypeTokenExchange},
+		SubjectTypesSupported:                      subjectTypesSupported(),
+		IDTokenSigningAlgValuesSupported:           []string{"RS256"},
+		CodeChallengeMethodsSupported:              []string{oauth.CodeChallengeMethodS256, oauth.CodeChallengeMethodPlain},
+		TokenEndpointAuthMethodsSupported:          tokenEndpointAuthMethods,
+		TokenEndpointAuthSigningAlgValuesSupported: helper.ClientSigningAlgs,
+		RequestParameterSupported:                  true,
+		RequestObjectSigningAlgValuesSupported:     helper.ClientSigningAlgs,
+		DPoPSigningAlgValuesSupported:              helper.ClientSigningAlgs,
+		FrontchannelLogoutSupported:                true,
+		FrontchannelLogoutSessionSupported:         true,
+		BackchannelLogoutSupported:                 true,
+		BackchannelLogoutSessionSupported:          true,
+	}
+
+	if source.AppConfig.OAuth.Registration.Enabled {
+		config.RegistrationEndpoint = baseURL + "/api/v0/oauth/register"
 	}
 
 	c.JSON(http.StatusOK, config)
 }
 
+// subjectTypesSupported 返回支持的主体标识类型，配置了服务端密钥时才支持 pairwise
+func subjectTypesSupported() []string {
+	if pairwiseEnabled() {
+		return []string{oauth.SubjectTypePublic, oauth.SubjectTypePairwise}
+	}
+	return []string{oauth.SubjectTypePublic}
+}
+
+// OIDCUserInfo 处理 UserInfo 请求，使用 OAuth 访问令牌鉴权
+// 根据令牌的权限范围返回对应的标准声明
+func OIDCUserInfo(c *gin.Context) {
+	value, exists := c.Get("oauthToken")
+	if !exists {
+		SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "access token not found")
+		return
+	}
+	token := value.(*oauth.Token)
+
+	// client_credentials 签发的令牌没有关联用户
+	if token.UserID == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="Nyauth", error="invalid_token"`)
+		SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "access token is not bound to a user")
+		return
+	}
+
+	// 以多身份签发的令牌只返回该身份的信息，不暴露主账号
+	claims, err := profileClaims(token.UserID, token.IdentityID, token.Scope)
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("profileClaims err: %s\n", err.Error())
+		return
+	}
+	if claims == nil {
+		c.Header("WWW-Authenticate", `Bearer realm="Nyauth", error="invalid_token"`)
+		SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "the user of this access token no longer exists")
+		return
+	}
+	claims["sub"] = token.Subject()
+
+	c.JSON(http.StatusOK, claims)
+}
+
+// profileClaims 根据权限范围构造用户的标准声明，不包含 sub
+// identityID 不为空时返回该身份的名称、头像与邮箱，不暴露主账号；用户或身份不存在时返回 nil
+func profileClaims(userID, identityID string, scope []string) (gin.H, error) {
+	var name, picture, email string
+	if identityID != "" {
+		identity, err := database.GetIdentityByID(identityID)
+		if err != nil {
+			return nil, err
+		}
+		if identity == nil || identity.Attributed != userID {
+			return nil, nil
+		}
+		name, picture, email = identity.DisplayName, identity.Avatar, identity.UserEmail
+	} else {
+		user, err := database.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, nil
+		}
+		name, picture, email = user.Username, user.Avatar, user.UserEmail
+	}
+
+	claims := gin.H{}
+
+	if scopeHasAny(scope, profileScopes) {
+		claims["name"] = name
+		claims["preferred_username"] = name
+		claims["picture"] = picture
+	}
+
+	if scopeHasAny(scope, emailScopes) {
+		claims["email"] = email
+		// 注册账号与创建身份时均已通过邮箱验证码验证
+		claims["email_verified"] = true
+	}
+
+	return claims, nil
+}
+
+// scopeHasAny 检查权限范围是否包含任一指定的权限
+func scopeHasAny(scope []string, targets []string) bool {
+	for _, target := range targets {
+		if oauth.ValidateScope(scope, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // 返回用于验证签名的公钥信息
 func GetJWKS(c *gin.Context) {
 	// 获取公钥
@@ -80,10 +202,10 @@ func rsaPublicKeyToJWK(pubKey *rsa.PublicKey) JWK {
 	}
 
 	return JWK{
-		Kid: "Nyauth-Server", // 密钥ID
-		Kty: "RSA",           // 密钥类型
-		Use: "sig",           // 用途：签名
-		Alg: "RS256",         // 算法
+		Kid: helper.SigningKeyID, // 密钥ID
+		Kty: "RSA",               // 密钥类型
+		Use: "sig",               // 用途：签名
+		Alg: "RS256",             // 算法
 		N:   untils.Base64URLEncode(nBytes),
 		E:   untils.Base64URLEncode(e),
 	}
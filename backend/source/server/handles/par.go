@@ -0,0 +1,80 @@
+package handles
+
+import (
+	"fmt"
+	"net/http"
+	"nyauth_backed/source/oauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 客户端认证使用的参数，不属于授权请求，不随请求一起保存
+var clientAuthParams = []string{"client_secret", "client_assertion", "client_assertion_type"}
+
+// OAuthPushedAuthorization PAR 端点 (RFC 9126)，客户端提交授权请求参数后换取 request_uri
+// 参数的校验规则与授权端点相同，校验失败时直接返回给客户端
+func OAuthPushedAuthorization(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	client, ok := authenticateClient(c)
+	if !ok {
+		return
+	}
+	clientID := client.ID.Hex()
+
+	params := c.Request.PostForm
+	for _, key := range clientAuthParams {
+		params.Del(key)
+	}
+
+	// request_uri 不能嵌套使用
+	if params.Has("request_uri") {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "request_uri is not allowed in a pushed authorization request")
+		return
+	}
+
+	// 请求对象在此验证后展开保存，授权端点不再重复验证
+	if client.RequireSignedRequestObject && !params.Has("request") {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "this client must use a signed request object")
+		return
+	}
+	params, replay, err := resolveRequestObject(client, params)
+	if err != nil {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request_object", "request object is invalid")
+		fmt.Printf("resolveRequestObject err: %s\n", err.Error())
+		return
+	}
+	if !replay.markUsed() {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request_object", "request object has already been used")
+		return
+	}
+	params.Set("client_id", clientID)
+
+	req := parseAuthorizeRequest(params)
+
+	if req.RedirectURI == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "redirect_uri is required")
+		return
+	}
+	if !oauth.MatchRedirectURI(clientRedirectURIs(client), req.RedirectURI) {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "redirect_uri does not match a registered redirect URI")
+		return
+	}
+
+	if authErr := validateAuthorizeRequest(client, req); authErr != nil {
+		SendOAuthError(c, http.StatusBadRequest, authErr.Code, authErr.Description)
+		return
+	}
+
+	requestURI, expiresIn, err := oauth.CreatePushedRequest(clientID, params)
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("CreatePushedRequest err: %s\n", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"request_uri": requestURI,
+		"expires_in":  expiresIn,
+	})
+}
@@ -0,0 +1,126 @@
+package handles
+
+import (
+	"fmt"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 支持的 prompt 取值 (OIDC Core §3.1.2.1)
+var promptValues = []string{"none", "login", "consent", "select_account"}
+
+// hasPrompt 检查授权请求的 prompt 是否包含指定的值
+func (req *authorizeRequest) hasPrompt(value string) bool {
+	return slices.Contains(req.Prompt, value)
+}
+
+// validatePrompt 校验 prompt 与 max_age 参数
+func validatePrompt(req *authorizeRequest) *authorizeError {
+	for _, p := range req.Prompt {
+		if !slices.Contains(promptValues, p) {
+			return &authorizeError{"invalid_request", "unsupported prompt value: " + p, "不支持的 prompt"}
+		}
+	}
+	// none 不能与其他值同时使用
+	if req.hasPrompt("none") && len(req.Prompt) > 1 {
+		return &authorizeError{"invalid_request", "prompt=none cannot be combined with other values", "prompt=none 不能与其他值同时使用"}
+	}
+
+	if req.MaxAge != "" {
+		if maxAge, err := strconv.Atoi(req.MaxAge); err != nil || maxAge < 0 {
+			return &authorizeError{"invalid_request", "max_age must be a non-negative integer", "max_age 格式不正确"}
+		}
+	}
+
+	return nil
+}
+
+// checkAuthentication 检查用户当前的登录是否满足授权请求对认证的要求
+// prompt=login、登录时间超过 max_age、与 id_token_hint 或 login_hint 不是同一用户时，返回 login_required
+func checkAuthentication(c *gin.Context, client *models.DatabaseClient, req *authorizeRequest) *authorizeError {
+	loginRequired := &authorizeError{"login_required", "the user must authenticate", "请重新登录"}
+
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		return loginRequired
+	}
+	mapClaims := claims.(jwt.MapClaims)
+	userID := mapClaims["data"].(map[string]interface{})["user_id"].(string)
+
+	// 用户在授权请求要求重新登录之后完成了登录，prompt=login 与 max_age 均已满足
+	// 门户 JWT 的签发时间只精确到秒，比较时需要去掉毫秒
+	reauthenticated := false
+	if req.LoginState != "" {
+		if requestedAt, ok := oauth.GetLoginRequest(req.LoginState, client.ID.Hex()); ok {
+			reauthenticated = !portalAuthTime(mapClaims).Before(requestedAt.Truncate(time.Second))
+		}
+	}
+
+	if req.hasPrompt("login") && !reauthenticated {
+		return loginRequired
+	}
+
+	if req.MaxAge != "" && !reauthenticated {
+		maxAge, _ := strconv.Atoi(req.MaxAge)
+		if time.Since(portalAuthTime(mapClaims)) > time.Duration(maxAge)*time.Second {
+			return loginRequired
+		}
+	}
+
+	// id_token_hint 必须是本服务签发给该应用的 ID 令牌，允许已过期
+	if req.IDTokenHint != "" {
+		hint, err := helper.JwtHelper.ParseIDToken(req.IDTokenHint)
+		if err != nil {
+			return &authorizeError{"invalid_request", "id_token_hint is invalid", "id_token_hint 无效"}
+		}
+		audience, err := hint.GetAudience()
+		if err != nil || !slices.Contains(audience, client.ID.Hex()) {
+			return &authorizeError{"invalid_request", "id_token_hint was not issued to this client", "id_token_hint 无效"}
+		}
+		// 应用拿到的 sub 可能是所选身份或 pairwise 主体，需要按应用计算后比较
+		identityID, authErr := authorizeIdentity(userID, req.IdentityID)
+		if authErr != nil {
+			return authErr
+		}
+		expected, err := clientSubject(client, userID, identityID)
+		if err != nil {
+			fmt.Printf("clientSubject err: %s\n", err.Error())
+			return &authorizeError{"server_error", "", "获取用户标识失败"}
+		}
+		if subject, _ := hint.GetSubject(); subject != expected {
+			return loginRequired
+		}
+	}
+
+	// login_hint 可以是用户名或邮箱
+	if req.LoginHint != "" {
+		user, err := database.GetUserByID(userID)
+		if err != nil {
+			fmt.Printf("GetUserByID err: %s\n", err.Error())
+			return &authorizeError{"server_error", "", "获取用户信息失败"}
+		}
+		if user == nil || (!strings.EqualFold(req.LoginHint, user.Username) && !strings.EqualFold(req.LoginHint, user.UserEmail)) {
+			return loginRequired
+		}
+	}
+
+	return nil
+}
+
+// portalAuthTime 返回用户实际登录的时间，即门户 JWT 的签发时间
+func portalAuthTime(claims jwt.MapClaims) time.Time {
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return time.Now()
+	}
+	return iat.Time
+}
@@ -0,0 +1,404 @@
+package handles
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"nyauth_backed/source"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"nyauth_backed/source/untils"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 动态注册支持的令牌端点认证方式
+var registrationAuthMethods = []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"}
+
+// 动态注册支持的授权类型
+var registrationGrantTypes = []string{"authorization_code", "refresh_token", "client_credentials", oauth.GrantTypeDeviceCode, oauth.GrantTypeTokenExchange}
+
+// 不以用户授权为前提的授权类型，动态注册的客户端需要在配置中开放后才能使用
+var privilegedGrantTypes = []string{"client_credentials", oauth.GrantTypeTokenExchange}
+
+// RegisterClient 动态客户端注册 (RFC 7591)
+func RegisterClient(c *gin.Context) {
+	registration := source.AppConfig.OAuth.Registration
+	if !registration.Enabled {
+		SendOAuthError(c, http.StatusNotFound, "not_found", "dynamic client registration is disabled")
+		return
+	}
+
+	// 只有持有初始访问令牌的调用方才能注册，除非明确允许匿名注册
+	if len(registration.InitialAccessTokens) > 0 || !registration.AllowAnonymous {
+		if !matchInitialAccessToken(bearerToken(c), registration.InitialAccessTokens) {
+			c.Header("WWW-Authenticate", `Bearer realm="Nyauth", error="invalid_token"`)
+			SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "initial access token is invalid")
+			return
+		}
+	}
+
+	var req models.ClientRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_client_metadata", "request body is not valid client metadata")
+		return
+	}
+
+	dbClient, errCode, errMsg := clientFromMetadata(req)
+	if dbClient == nil {
+		SendOAuthError(c, http.StatusBadRequest, errCode, errMsg)
+		return
+	}
+
+	// 公开客户端不颁发密钥
+	var clientSecret string
+	var err error
+	if !dbClient.PublicClient {
+		var secretRecord models.DatabaseClientSecret
+		clientSecret, secretRecord, err = generateClientSecret()
+		if err != nil {
+			sendServerError(c)
+			return
+		}
+		dbClient.ClientSecrets = []models.DatabaseClientSecret{secretRecord}
+	}
+
+	registrationToken, err := untils.GenerateRandomCode(48, false)
+	if err != nil {
+		sendServerError(c)
+		return
+	}
+	dbClient.RegistrationAccessToken = untils.SHA256(registrationToken)
+
+	if _, err := database.CreateClient(dbClient); err != nil {
+		sendServerError(c)
+		fmt.Printf("CreateClient err: %s\n", err.Error())
+		return
+	}
+
+	// 密钥与注册访问令牌只在注册时返回一次
+	response := registeredClientResponse(dbClient)
+	response["registration_access_token"] = registrationToken
+	if clientSecret != "" {
+		response["client_secret"] = clientSecret
+		response["client_secret_expires_at"] = 0
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetRegisteredClient 读取已注册的客户端信息 (RFC 7592)
+func GetRegisteredClient(c *gin.Context) {
+	dbClient, ok := authenticateRegistration(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, registeredClientResponse(dbClient))
+}
+
+// UpdateRegisteredClient 更新已注册的客户端信息 (RFC 7592)，请求体为完整的客户端元数据
+func UpdateRegisteredClient(c *gin.Context) {
+	dbClient, ok := authenticateRegistration(c)
+	if !ok {
+		return
+	}
+
+	var req models.ClientRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_client_metadata", "request body is not valid client metadata")
+		return
+	}
+
+	updated, errCode, errMsg := clientFromMetadata(req)
+	if updated == nil {
+		SendOAuthError(c, http.StatusBadRequest, errCode, errMsg)
+		return
+	}
+
+	// 注册后不允许在公开客户端与机密客户端之间切换，机密客户端可以更换认证方式
+	if updated.PublicClient != dbClient.PublicClient {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_client_metadata", "token_endpoint_auth_method cannot switch between public and confidential")
+		return
+	}
+
+	err := database.UpdateClient(dbClient.ID.Hex(), map[string]interface{}{
+		"client_name":   updated.ClientName,
+		"avatar":        updated.Avatar,
+		"redirect_uris": updated.RedirectURIs,
+		"grant_types":   updated.GrantTypes,
+		"permissions":   updated.Permissions,
+
+		"token_endpoint_auth_method": updated.TokenEndpointAuthMethod,
+		"jwks":                       updated.JWKS,
+
+		"require_pushed_authorization_requests": updated.RequirePushedAuthorizationRequests,
+		"require_signed_request_object":         updated.RequireSignedRequestObject,
+		"access_token_format":                   updated.AccessTokenFormat,
+
+		"subject_type":          updated.SubjectType,
+		"sector_identifier_uri": updated.SectorIdentifierURI,
+
+		"post_logout_redirect_uris":            updated.PostLogoutRedirectURIs,
+		"frontchannel_logout_uri":              updated.FrontchannelLogoutURI,
+		"frontchannel_logout_session_required": updated.FrontchannelLogoutSessionRequired,
+		"backchannel_logout_uri":               updated.BackchannelLogoutURI,
+		"backchannel_logout_session_required":  updated.BackchannelLogoutSessionRequired,
+	})
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("UpdateClient err: %s\n", err.Error())
+		return
+	}
+
+	// 重新读取更新后的客户端，响应与数据库保持一致
+	dbClient, err = database.GetClientByClientID(dbClient.ID.Hex())
+	if err != nil || dbClient == nil {
+		sendServerError(c)
+		if err != nil {
+			fmt.Printf("GetClientByClientID err: %s\n", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, registeredClientResponse(dbClient))
+}
+
+// DeleteRegisteredClient 删除已注册的客户端 (RFC 7592)，并吊销其签发的全部令牌
+func DeleteRegisteredClient(c *gin.Context) {
+	dbClient, ok := authenticateRegistration(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DeleteClient(dbClient.ID.Hex()); err != nil {
+		sendServerError(c)
+		fmt.Printf("DeleteClient err: %s\n", err.Error())
+		return
+	}
+
+	oauth.RevokeClientTokens(dbClient.ID.Hex(), "")
+	if err := database.DeleteAuthorizationsByClient(dbClient.ID.Hex()); err != nil {
+		fmt.Printf("DeleteAuthorizationsByClient err: %s\n", err.Error())
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// authenticateRegistration 使用注册访问令牌验证客户端管理请求
+// 验证失败时已写入响应，调用方直接返回即可
+func authenticateRegistration(c *gin.Context) (*models.DatabaseClient, bool) {
+	token := bearerToken(c)
+	if token == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="Nyauth"`)
+		SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "authorization header format must be Bearer {token}")
+		return nil, false
+	}
+
+	dbClient, err := database.GetClientByClientID(c.Param("client_id"))
+	if err != nil || dbClient == nil || dbClient.RegistrationAccessToken == "" ||
+		subtle.ConstantTimeCompare([]byte(untils.SHA256(token)), []byte(dbClient.RegistrationAccessToken)) != 1 {
+		// 客户端不存在与令牌错误返回相同的结果，避免探测客户端ID
+		c.Header("WWW-Authenticate", `Bearer realm="Nyauth", error="invalid_token"`)
+		SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "registration access token is invalid")
+		return nil, false
+	}
+
+	return dbClient, true
+}
+
+// clientFromMetadata 校验客户端元数据并转换为客户端文档
+// 校验失败时返回 nil 以及 RFC 7591 规定的错误码和英文描述
+func clientFromMetadata(req models.ClientRegistrationRequest) (*models.DatabaseClient, string, string) {
+	// 未指定时按 RFC 7591 默认为 client_secret_basic
+	authMethod := req.TokenEndpointAuthMethod
+	if authMethod == "" {
+		authMethod = "client_secret_basic"
+	}
+	if !slices.Contains(registrationAuthMethods, authMethod) {
+		return nil, "invalid_client_metadata", "unsupported token_endpoint_auth_method"
+	}
+
+	// private_key_jwt 需要提交用于验证断言的公钥集
+	var jwks string
+	if len(req.JWKS) > 0 && string(req.JWKS) != "null" {
+		if _, err := helper.ParseJWKSet(string(req.JWKS)); err != nil {
+			return nil, "invalid_client_metadata", "jwks is not a valid JWK Set"
+		}
+		jwks = string(req.JWKS)
+	}
+	if authMethod == "private_key_jwt" && jwks == "" {
+		return nil, "invalid_client_metadata", "private_key_jwt requires jwks"
+	}
+	if req.RequireSignedRequestObject && jwks == "" {
+		return nil, "invalid_client_metadata", "require_signed_request_object requires jwks"
+	}
+	if !oauth.IsSupportedTokenFormat(req.AccessTokenFormat) {
+		return nil, "invalid_client_metadata", "unsupported access_token_format"
+	}
+
+	for _, uri := range req.PostLogoutRedirectURIs {
+		if err := oauth.ValidateRedirectURI(uri); err != nil {
+			return nil, "invalid_client_metadata", "invalid post_logout_redirect_uri: " + uri
+		}
+	}
+	if req.FrontchannelLogoutURI != "" && oauth.ValidateFrontchannelLogoutURI(req.FrontchannelLogoutURI) != nil {
+		return nil, "invalid_client_metadata", "invalid frontchannel_logout_uri"
+	}
+	if req.BackchannelLogoutURI != "" && oauth.ValidateBackchannelLogoutURI(req.BackchannelLogoutURI) != nil {
+		return nil, "invalid_client_metadata", "invalid backchannel_logout_uri"
+	}
+
+	grantTypes := req.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{"authorization_code"}
+	}
+	registration := source.AppConfig.OAuth.Registration
+	for _, grantType := range grantTypes {
+		if !slices.Contains(registrationGrantTypes, grantType) {
+			return nil, "invalid_client_metadata", "unsupported grant_type: " + grantType
+		}
+		if slices.Contains(privilegedGrantTypes, grantType) && !slices.Contains(registration.PrivilegedGrantTypes, grantType) {
+			return nil, "invalid_client_metadata", "grant_type not allowed for registered clients: " + grantType
+		}
+	}
+
+	publicClient := authMethod == "none"
+	if publicClient && slices.Contains(grantTypes, "client_credentials") {
+		return nil, "invalid_client_metadata", "public clients cannot use client_credentials"
+	}
+	if publicClient && slices.Contains(grantTypes, oauth.GrantTypeTokenExchange) {
+		return nil, "invalid_client_metadata", "public clients cannot use token exchange"
+	}
+
+	// 使用授权码模式时必须注册至少一个重定向URI
+	if slices.Contains(grantTypes, "authorization_code") && len(req.RedirectURIs) == 0 {
+		return nil, "invalid_redirect_uri", "redirect_uris is required"
+	}
+	for _, uri := range req.RedirectURIs {
+		if err := oauth.ValidateRedirectURI(uri); err != nil {
+			return nil, "invalid_redirect_uri", "invalid redirect_uri: " + uri
+		}
+	}
+
+	if !oauth.IsSupportedSubjectType(req.SubjectType) {
+		return nil, "invalid_client_metadata", "unsupported subject_type"
+	}
+	if req.SubjectType == oauth.SubjectTypePairwise && !pairwiseEnabled() {
+		return nil, "invalid_client_metadata", "pairwise subject_type is not enabled"
+	}
+	if req.SectorIdentifierURI != "" {
+		if err := validateSectorIdentifier(req.SectorIdentifierURI, req.RedirectURIs); err != nil {
+			return nil, "invalid_client_metadata", "invalid sector_identifier_uri: " + err.Error()
+		}
+	}
+
+	return &models.DatabaseClient{
+		ClientName:   req.ClientName,
+		Avatar:       req.LogoURI,
+		RedirectURIs: req.RedirectURIs,
+		Permissions:  registrationScope(req.Scope, registration.AllowedScopes),
+		PublicClient: publicClient,
+		GrantTypes:   grantTypes,
+
+		TokenEndpointAuthMethod: authMethod,
+		JWKS:                    jwks,
+
+		RequirePushedAuthorizationRequests: req.RequirePushedAuthorizationRequests,
+		RequireSignedRequestObject:         req.RequireSignedRequestObject,
+		AccessTokenFormat:                  req.AccessTokenFormat,
+
+		SubjectType:         req.SubjectType,
+		SectorIdentifierURI: req.SectorIdentifierURI,
+
+		PostLogoutRedirectURIs:            req.PostLogoutRedirectURIs,
+		FrontchannelLogoutURI:             req.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: req.FrontchannelLogoutSessionRequired,
+		BackchannelLogoutURI:              req.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  req.BackchannelLogoutSessionRequired,
+	}, "", ""
+}
+
+// registeredClientResponse 构造客户端元数据响应，不包含任何密钥
+func registeredClientResponse(dbClient *models.DatabaseClient) gin.H {
+	clientID := dbClient.ID.Hex()
+
+	authMethod := clientAuthMethods(dbClient)[0]
+
+	grantTypes := dbClient.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = defaultGrantTypes
+	}
+
+	response := gin.H{
+		"client_id":                  clientID,
+		"client_id_issued_at":        dbClient.CreatedAt.Time().Unix(),
+		"client_name":                dbClient.ClientName,
+		"logo_uri":                   dbClient.Avatar,
+		"redirect_uris":              clientRedirectURIs(dbClient),
+		"grant_types":                grantTypes,
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": authMethod,
+		"scope":                      strings.Join(dbClient.Permissions, " "),
+		"registration_client_uri":    source.AppConfig.Server.BaseURL + "/api/v0/oauth/register/" + clientID,
+
+		"require_pushed_authorization_requests": dbClient.RequirePushedAuthorizationRequests,
+		"require_signed_request_object":         dbClient.RequireSignedRequestObject,
+		"access_token_format":                   clientAccessTokenFormat(dbClient),
+		"subject_type":                          clientSubjectType(dbClient),
+	}
+	if dbClient.SectorIdentifierURI != "" {
+		response["sector_identifier_uri"] = dbClient.SectorIdentifierURI
+	}
+	if len(dbClient.PostLogoutRedirectURIs) > 0 {
+		response["post_logout_redirect_uris"] = dbClient.PostLogoutRedirectURIs
+	}
+	if dbClient.FrontchannelLogoutURI != "" {
+		response["frontchannel_logout_uri"] = dbClient.FrontchannelLogoutURI
+		response["frontchannel_logout_session_required"] = dbClient.FrontchannelLogoutSessionRequired
+	}
+	if dbClient.BackchannelLogoutURI != "" {
+		response["backchannel_logout_uri"] = dbClient.BackchannelLogoutURI
+		response["backchannel_logout_session_required"] = dbClient.BackchannelLogoutSessionRequired
+	}
+	if dbClient.JWKS != "" {
+		response["jwks"] = json.RawMessage(dbClient.JWKS)
+	}
+	return response
+}
+
+// registrationScope 返回注册的客户端获得的权限，超出配置允许范围的部分被忽略 (RFC 7591 §2)
+// 标准 OIDC 权限范围（如 profile、email）先换算为所需的应用权限，openid 等无需权限的范围不计入
+func registrationScope(requested string, allowed []string) []string {
+	permissions := []string{}
+	for _, scope := range oauth.ParseScope(requested) {
+		if permission, isOIDCScope := oauth.ScopePermission(scope); isOIDCScope {
+			if permission == "" {
+				continue
+			}
+			scope = permission
+		}
+		if oauth.ValidateScope(allowed, scope) && !slices.Contains(permissions, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+	return permissions
+}
+
+// matchInitialAccessToken 检查初始访问令牌是否在配置的列表中
+func matchInitialAccessToken(token string, allowed []string) bool {
+	if token == "" {
+		return false
+	}
+	for _, t := range allowed {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
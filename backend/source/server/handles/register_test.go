@@ -0,0 +1,31 @@
+package handles
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRegistrationScope(t *testing.T) {
+	allowed := []string{"user:info", "user:email"}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      []string
+	}{
+		{"OIDC 范围换算为应用权限", "openid profile email", []string{"user:info", "user:email"}},
+		{"无需权限的范围不计入", "openid offline_access", []string{}},
+		{"应用权限原样保留", "user:info", []string{"user:info"}},
+		{"换算后去重", "profile user:info", []string{"user:info"}},
+		{"超出允许范围的部分被忽略", "user:info admin:all user:*", []string{"user:info"}},
+		{"空请求", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registrationScope(tt.requested, allowed); !slices.Equal(got, tt.want) {
+				t.Errorf("registrationScope(%q) = %v, want %v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
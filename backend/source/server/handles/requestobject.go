@@ -0,0 +1,106 @@
+package handles
+
+import (
+	"errors"
+	"net/url"
+	"nyauth_backed/source"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 请求对象中只用于验证 JWT 本身的声明，不作为授权参数
+var requestObjectJWTClaims = []string{"iss", "aud", "exp", "iat", "nbf", "jti", "sub"}
+
+// requestObjectReplay 请求对象的 jti，请求对象被使用后记录，防止被重放
+type requestObjectReplay struct {
+	key string
+	exp time.Time
+}
+
+// markUsed 记录请求对象已被使用，已使用过时返回 false，没有请求对象时总是返回 true
+func (r *requestObjectReplay) markUsed() bool {
+	if r == nil {
+		return true
+	}
+	return oauth.MarkJTIUsed(r.key, r.exp)
+}
+
+// resolveRequestObject 验证 request 参数中的请求对象 (RFC 9101)，返回请求对象中的授权参数
+// 请求对象必须由客户端使用注册的 JWKS 签名，iss 为 client_id，aud 为本服务的签发者
+// 只使用请求对象中的参数，请求参数中除 client_id 以外的值全部忽略 (RFC 9101 §6.3)
+// 没有 request 参数时原样返回 params
+func resolveRequestObject(client *models.DatabaseClient, params url.Values) (url.Values, *requestObjectReplay, error) {
+	requestObject := params.Get("request")
+	if requestObject == "" {
+		return params, nil, nil
+	}
+
+	if params.Has("request_uri") {
+		return nil, nil, errors.New("request and request_uri cannot be used together")
+	}
+
+	if client.JWKS == "" {
+		return nil, nil, errors.New("client has no registered jwks")
+	}
+	keys, err := helper.ParseJWKSet(client.JWKS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientID := client.ID.Hex()
+	claims, err := helper.ParseJWTWithJWKS(requestObject, keys,
+		jwt.WithIssuer(clientID),
+		jwt.WithAudience(source.AppConfig.Server.BaseURL),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 请求对象中的 client_id 必须与请求参数一致
+	if claimClientID, exists := claims["client_id"]; exists && claimClientID != clientID {
+		return nil, nil, errors.New("client_id in request object does not match")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, nil, errors.New("request object jti is missing")
+	}
+	exp, _ := claims.GetExpirationTime()
+
+	// 请求对象有效期不应过长，避免被长期重放
+	if time.Until(exp.Time) > time.Hour {
+		return nil, nil, errors.New("request object lifetime is too long")
+	}
+
+	replay := &requestObjectReplay{key: "request_object:" + clientID + ":" + jti, exp: exp.Time}
+	if oauth.IsJTIUsed(replay.key) {
+		return nil, nil, errors.New("request object jti has been used")
+	}
+
+	resolved := url.Values{}
+	resolved.Set("client_id", clientID)
+
+	for key, value := range claims {
+		if slices.Contains(requestObjectJWTClaims, key) {
+			continue
+		}
+		// 结构化的声明（如 claims）暂不支持，直接忽略
+		switch v := value.(type) {
+		case string:
+			resolved.Set(key, v)
+		case float64:
+			resolved.Set(key, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			resolved.Set(key, strconv.FormatBool(v))
+		}
+	}
+
+	return resolved, replay, nil
+}
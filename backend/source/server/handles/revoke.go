@@ -0,0 +1,64 @@
+package handles
+
+import (
+	"net/http"
+	"nyauth_backed/source/oauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthRevoke 令牌吊销端点 (RFC 7009)
+// 吊销刷新令牌时会一并吊销由它派生出的访问令牌
+func OAuthRevoke(c *gin.Context) {
+	token := c.PostForm("token")
+	tokenTypeHint := c.PostForm("token_type_hint")
+
+	if token == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	client, ok := authenticateClient(c)
+	if !ok {
+		return
+	}
+	clientID := client.ID.Hex()
+
+	// 按 token_type_hint 决定查找顺序，找不到时再尝试另一种令牌
+	if tokenTypeHint == "refresh_token" {
+		if !revokeRefreshToken(token, clientID) {
+			revokeAccessToken(token, clientID)
+		}
+	} else {
+		if !revokeAccessToken(token, clientID) {
+			revokeRefreshToken(token, clientID)
+		}
+	}
+
+	// 无论令牌是否存在都返回 200，避免泄露令牌状态
+	c.Status(http.StatusOK)
+}
+
+// revokeAccessToken 吊销属于该客户端的访问令牌，返回令牌是否被找到
+func revokeAccessToken(token, clientID string) bool {
+	tokenObj, exists := oauth.GetToken(token)
+	if !exists {
+		return false
+	}
+	if tokenObj.ClientID == clientID {
+		oauth.RemoveToken(token)
+	}
+	return true
+}
+
+// revokeRefreshToken 吊销属于该客户端的刷新令牌及其整个令牌族，返回令牌是否被找到
+func revokeRefreshToken(token, clientID string) bool {
+	refreshToken, exists := oauth.GetRefreshToken(token)
+	if !exists {
+		return false
+	}
+	if refreshToken.ClientID == clientID {
+		oauth.RevokeTokenFamily(refreshToken.FamilyID)
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package handles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"nyauth_backed/source"
+	"nyauth_backed/source/database"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"slices"
+	"time"
+)
+
+// 拉取 sector_identifier_uri 使用的 HTTP 客户端，地址由注册方提供，与后端登出通知一样只允许连接公网地址且不跟随重定向
+var sectorIdentifierClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublicAddressOnly}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// pairwiseEnabled 是否配置了计算 pairwise 主体标识的服务端密钥
+func pairwiseEnabled() bool {
+	return source.AppConfig.OAuth.PairwiseSecret != ""
+}
+
+// clientSubjectType 返回客户端的主体标识类型，未设置时为 public
+func clientSubjectType(client *models.DatabaseClient) string {
+	if client.SubjectType == "" {
+		return oauth.SubjectTypePublic
+	}
+	return client.SubjectType
+}
+
+// clientSubject 返回向客户端展示的主体标识
+// public 类型为用户ID，以多身份签发时为身份的 UUID，不暴露主账号；pairwise 类型由客户端的扇区标识与用户（或身份）的 UUID 计算
+func clientSubject(client *models.DatabaseClient, userID, identityID string) (string, error) {
+	pairwise := client.SubjectType == oauth.SubjectTypePairwise
+	if !pairwise && identityID == "" {
+		return userID, nil
+	}
+	if pairwise && !pairwiseEnabled() {
+		return "", errors.New("pairwise_secret is not configured")
+	}
+
+	var userUUID string
+	if identityID != "" {
+		identity, err := database.GetIdentityByID(identityID)
+		if err != nil {
+			return "", err
+		}
+		if identity == nil {
+			return "", fmt.Errorf("identity %s not found", identityID)
+		}
+		userUUID = identity.UserUUID
+	} else {
+		user, err := database.GetUserByID(userID)
+		if err != nil {
+			return "", err
+		}
+		if user == nil {
+			return "", fmt.Errorf("user %s not found", userID)
+		}
+		userUUID = user.UserUUID
+	}
+
+	if !pairwise {
+		return userUUID, nil
+	}
+	return oauth.PairwiseSubject(clientSector(client), userUUID, source.AppConfig.OAuth.PairwiseSecret), nil
+}
+
+// clientSector 返回客户端的扇区标识
+// 注册了 sector_identifier_uri 时为其主机名，同一扇区的应用看到相同的标识；否则每个客户端单独成为一个扇区
+func clientSector(client *models.DatabaseClient) string {
+	if client.SectorIdentifierURI != "" {
+		if u, err := url.Parse(client.SectorIdentifierURI); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	return client.ID.Hex()
+}
+
+// validateSectorIdentifier 拉取 sector_identifier_uri，其内容必须是包含客户端全部重定向URI的 JSON 数组 (OIDC Registration §5)
+func validateSectorIdentifier(uri string, redirectURIs []string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("must be an https URL")
+	}
+
+	resp, err := sectorIdentifierClient.Get(uri)
+	if err != nil {
+		return errors.New("failed to fetch the document")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching the document returned status %d", resp.StatusCode)
+	}
+
+	var sectorURIs []string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&sectorURIs); err != nil {
+		return errors.New("the document is not a JSON array of URIs")
+	}
+	for _, redirectURI := range redirectURIs {
+		if !slices.Contains(sectorURIs, redirectURI) {
+			return errors.New("redirect_uri not listed in the document: " + redirectURI)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+package handles
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"nyauth_backed/source"
+	"nyauth_backed/source/helper"
+	"nyauth_backed/source/logger"
+	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultGrantTypes 未配置 grant_types 的客户端默认允许的授权类型
+var defaultGrantTypes = []string{"authorization_code", "refresh_token"}
+
+// OAuthToken 令牌端点，验证客户端后根据 grant_type 分发到不同的授权流程
+// 错误按 RFC 6749 §5.2 返回，令牌响应不允许被缓存
+func OAuthToken(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	grantType := c.PostForm("grant_type")
+	if grantType == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	}
+
+	var grant func(c *gin.Context, client *models.DatabaseClient)
+	switch grantType {
+	case "authorization_code":
+		grant = authorizationCodeGrant
+	case "refresh_token":
+		grant = refreshTokenGrant
+	case "client_credentials":
+		grant = clientCredentialsGrant
+	case oauth.GrantTypeDeviceCode:
+		grant = deviceCodeGrant
+	case oauth.GrantTypeTokenExchange:
+		grant = tokenExchangeGrant
+	default:
+		SendOAuthError(c, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	client, ok := authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	// 携带 DPoP 证明时，签发的令牌绑定到证明的公钥
+	jkt, err := verifyDPoPProof(c, "")
+	if err != nil {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+		return
+	}
+	c.Set(dpopProofKey, jkt)
+
+	if !clientAllowsGrantType(client, grantType) {
+		SendOAuthError(c, http.StatusBadRequest, "unauthorized_client", "the client is not allowed to use this grant_type")
+		return
+	}
+
+	grant(c, client)
+}
+
+// clientAllowsGrantType 检查客户端是否允许使用指定的授权类型
+func clientAllowsGrantType(client *models.DatabaseClient, grantType string) bool {
+	grantTypes := client.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = defaultGrantTypes
+	}
+	for _, t := range grantTypes {
+		if t == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAccessTokenFormat 返回客户端的访问令牌格式，未设置时为 opaque
+func clientAccessTokenFormat(client *models.DatabaseClient) string {
+	if client.AccessTokenFormat == "" {
+		return oauth.TokenFormatOpaque
+	}
+	return client.AccessTokenFormat
+}
+
+// accessTokenTarget 根据 resource 参数 (RFC 8707) 确定访问令牌的受众与格式
+// 未指定 resource 时受众为本服务，格式使用客户端的设置；资源配置了格式时优先使用资源的格式
+// resource 未在配置中登记时返回 invalid_target 错误
+func accessTokenTarget(c *gin.Context, client *models.DatabaseClient, resource string) (string, string, bool) {
+	format := clientAccessTokenFormat(client)
+
+	if resource == "" {
+		return source.AppConfig.Server.BaseURL, format, true
+	}
+
+	if r := source.AppConfig.OAuth.FindResource(resource); r != nil {
+		if r.AccessTokenFormat != "" {
+			format = r.AccessTokenFormat
+		}
+		return resource, format, true
+	}
+
+	SendOAuthError(c, http.StatusBadRequest, "invalid_target", "unknown resource: "+resource)
+	return "", "", false
+}
+
+// authorizationCodeGrant 处理 grant_type=authorization_code
+func authorizationCodeGrant(c *gin.Context, client *models.DatabaseClient) {
+	code := c.PostForm("code")
+	redirectURI := c.PostForm("redirect_uri")
+	codeVerifier := c.PostForm("code_verifier")
+	nonce := c.PostForm("nonce")
+
+	// 验证必要参数，使用 PKCE 的公开客户端可以不提供 client_secret
+	if code == "" || redirectURI == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "code and redirect_uri are required")
+		return
+	}
+
+	// 资源不合法时不消耗授权码
+	audience, format, ok := accessTokenTarget(c, client, c.PostForm("resource"))
+	if !ok {
+		return
+	}
+
+	clientID := client.ID.Hex()
+
+	// 兑换授权码，授权码与授权时的 client_id 和 redirect_uri 绑定
+	authInfo, err := oauth.ConsumeAuthorizationCode(code, clientID, redirectURI)
+	if err != nil {
+		if errors.Is(err, oauth.ErrAuthorizationCodeReused) {
+			logger.Warning("Authorization code reused by client %s, issued tokens revoked", clientID)
+			SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "authorization code has already been used")
+			return
+		}
+		SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+		return
+	}
+
+	// 校验 PKCE code_verifier
+	if authInfo.CodeChallenge != "" {
+		if !oauth.VerifyCodeVerifier(codeVerifier, authInfo.CodeChallenge, authInfo.CodeChallengeMethod) {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+			return
+		}
+	} else if client.PublicClient {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "public clients must use PKCE")
+		return
+	}
+
+	// 由同一授权码签发的令牌属于同一令牌族，授权码被重放时可一并吊销
+	issueUserTokens(c, client, userGrant{
+		UserID:     authInfo.UserID,
+		IdentityID: authInfo.IdentityID,
+		Scope:      authInfo.Scope,
+		FamilyID:   authInfo.FamilyID,
+		SessionID:  authInfo.SessionID,
+		AuthTime:   authInfo.AuthTime,
+		Nonce:      nonce,
+		IDToken:    true,
+	}, audience, format)
+}
+
+// userGrant 用户同意授权后签发令牌所需的信息，来自授权码或设备授权
+type userGrant struct {
+	UserID     string
+	IdentityID string    // 用户选择的多身份ID，为空时代表用户本身
+	Scope      []string  // 用户同意的权限范围
+	FamilyID   string    // 令牌族ID，为空时开启新的令牌族
+	SessionID  string    // 授权时用户的登录会话ID
+	AuthTime   time.Time // 用户实际登录的时间
+	Nonce      string
+	IDToken    bool // 是否签发ID令牌
+}
+
+// issueUserTokens 按用户的授权签发访问令牌、刷新令牌与ID令牌，并写入令牌响应
+// 授予的权限范围为用户同意的范围与应用当前权限的交集，用户同意 offline_access 时才签发刷新令牌
+func issueUserTokens(c *gin.Context, client *models.DatabaseClient, grant userGrant, audience, format string) {
+	clientID := client.ID.Hex()
+
+	scope, invalid := oauth.GrantScope(grant.Scope, client.Permissions)
+	if len(invalid) > 0 {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_scope", "scope not allowed for this client: "+strings.Join(invalid, " "))
+		return
+	}
+
+	// 客户端使用 pairwise 主体时，令牌与ID令牌中的 sub 为针对该客户端计算的标识
+	subject, err := clientSubject(client, grant.UserID, grant.IdentityID)
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("clientSubject err: %s\n", err.Error())
+		return
+	}
+
+	familyID := grant.FamilyID
+	if familyID == "" {
+		familyID, err = oauth.NewFamilyID()
+		if err != nil {
+			sendServerError(c)
+			fmt.Printf("NewFamilyID err: %s\n", err.Error())
+			return
+		}
+	}
+
+	// ID令牌携带用户授权时选择的身份在权限范围内的资料
+	var idToken string
+	if grant.IDToken {
+		userClaims, err := profileClaims(grant.UserID, grant.IdentityID, scope)
+		if err != nil {
+			sendServerError(c)
+			fmt.Printf("profileClaims err: %s\n", err.Error())
+			return
+		}
+		if userClaims == nil {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "the user of this grant no longer exists")
+			return
+		}
+		idToken, err = helper.JwtHelper.IssueOIDCToken(subject, clientID, grant.Nonce, grant.SessionID, grant.AuthTime, userClaims, 6400)
+		if err != nil {
+			sendServerError(c)
+			fmt.Printf("IssueOIDCToken err: %s\n", err.Error())
+			return
+		}
+	}
+
+	var refreshToken string
+	if oauth.ContainsScope(scope, oauth.ScopeOfflineAccess) {
+		refreshToken, err = oauth.CreateRefreshToken(oauth.RefreshToken{
+			ClientID:   clientID,
+			UserID:     grant.UserID,
+			IdentityID: grant.IdentityID,
+			ClientSub:  subject,
+			Scope:      scope,
+			FamilyID:   familyID,
+			JKT:        refreshTokenJKT(c, client),
+		})
+		if err != nil {
+			sendServerError(c)
+			fmt.Printf("CreateRefreshToken err: %s\n", err.Error())
+			return
+		}
+	}
+
+	accessToken, err := oauth.CreateToken(oauth.Token{
+		ClientID:   clientID,
+		UserID:     grant.UserID,
+		IdentityID: grant.IdentityID,
+		ClientSub:  subject,
+		Scope:      scope,
+		FamilyID:   familyID,
+		Audience:   audience,
+		Format:     format,
+		JKT:        dpopJKT(c),
+	})
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("CreateToken err: %s\n", err.Error())
+		return
+	}
+
+	// 获取当前的token对象，以便返回过期时间
+	tokenObj, exists := oauth.GetToken(accessToken)
+	if !exists {
+		sendServerError(c)
+		return
+	}
+
+	response := gin.H{
+		"access_token": accessToken,
+		"token_type":   tokenObj.TokenType(),
+		"expires_in":   int(time.Until(tokenObj.Exp).Seconds()),
+		"scope":        strings.Join(tokenObj.Scope, " "),
+	}
+	if idToken != "" {
+		response["id_token"] = idToken
+	}
+	if refreshToken != "" {
+		response["refresh_token"] = refreshToken
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// refreshTokenGrant 处理 grant_type=refresh_token，每次使用都会轮换刷新令牌
+func refreshTokenGrant(c *gin.Context, client *models.DatabaseClient) {
+	refreshToken := c.PostForm("refresh_token")
+	if refreshToken == "" {
+		SendOAuthError(c, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	// 资源不合法时不轮换刷新令牌
+	audience, format, ok := accessTokenTarget(c, client, c.PostForm("resource"))
+	if !ok {
+		return
+	}
+
+	clientID := client.ID.Hex()
+
+	// 以下校验失败时不轮换刷新令牌，令牌不存在时由 RotateRefreshToken 返回错误
+	var scope []string
+	if rt, exists := oauth.GetRefreshToken(refreshToken); exists {
+		// 绑定了 DPoP 公钥的刷新令牌只能配合同一公钥的证明使用
+		if rt.JKT != "" && rt.JKT != dpopJKT(c) {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "refresh token is bound to a different DPoP key")
+			return
+		}
+
+		// 可以申请比原先更小的权限范围，但不能扩大
+		scope = rt.Scope
+		if requested := oauth.ParseScope(c.PostForm("scope")); len(requested) > 0 {
+			for _, s := range requested {
+				if !oauth.ContainsScope(rt.Scope, s) {
+					SendOAuthError(c, http.StatusBadRequest, "invalid_scope", "requested scope exceeds the original grant")
+					return
+				}
+			}
+			scope = requested
+		}
+
+		// 应用的权限被收回后，已签发的刷新令牌不能继续获得该权限
+		var invalid []string
+		scope, invalid = oauth.GrantScope(scope, client.Permissions)
+		if len(invalid) > 0 {
+			SendOAuthError(c, http.StatusBadRequest, "invalid_scope", "scope not allowed for this client: "+strings.Join(invalid, " "))
+			return
+		}
+	}
+
+	oldToken, err := oauth.RotateRefreshToken(refreshToken, clientID)
+	if err != nil {
+		if errors.Is(err, oauth.ErrRefreshTokenReused) {
+			logger.Warning("Refresh token reused by client %s, token family revoked", clientID)
+			SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "refresh token has already been used")
+			return
+		}
+		SendOAuthError(c, http.StatusBadRequest, "invalid_grant", "refresh token is invalid or expired")
+		return
+	}
+
+	// 轮换出新的刷新令牌，仍属于原令牌族
+	newRefreshToken, err := oauth.CreateRefreshToken(oauth.RefreshToken{
+		ClientID:   clientID,
+		UserID:     oldToken.UserID,
+		IdentityID: oldToken.IdentityID,
+		ClientSub:  oldToken.ClientSub,
+		Scope:      oldToken.Scope,
+		FamilyID:   oldToken.FamilyID,
+		JKT:        oldToken.JKT,
+	})
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("CreateRefreshToken err: %s\n", err.Error())
+		return
+	}
+
+	accessToken, err := oauth.CreateToken(oauth.Token{
+		ClientID:   clientID,
+		UserID:     oldToken.UserID,
+		IdentityID: oldToken.IdentityID,
+		ClientSub:  oldToken.ClientSub,
+		Scope:      scope,
+		FamilyID:   oldToken.FamilyID,
+		Audience:   audience,
+		Format:     format,
+		JKT:        dpopJKT(c),
+	})
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("CreateToken err: %s\n", err.Error())
+		return
+	}
+
+	tokenObj, exists := oauth.GetToken(accessToken)
+	if !exists {
+		sendServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"token_type":    tokenObj.TokenType(),
+		"expires_in":    int(time.Until(tokenObj.Exp).Seconds()),
+		"scope":         strings.Join(tokenObj.Scope, " "),
+		"refresh_token": newRefreshToken,
+	})
+}
+
+// clientCredentialsGrant 处理 grant_type=client_credentials，令牌不关联任何用户
+func clientCredentialsGrant(c *gin.Context, client *models.DatabaseClient) {
+	// 公开客户端无法证明自己的身份
+	if client.PublicClient {
+		SendOAuthError(c, http.StatusBadRequest, "unauthorized_client", "public clients cannot use client_credentials")
+		return
+	}
+
+	// 未指定 scope 时授予客户端的全部权限
+	scope := client.Permissions
+	if requested := oauth.ParseScope(c.PostForm("scope")); len(requested) > 0 {
+		for _, s := range requested {
+			if !oauth.ValidateScope(client.Permissions, s) {
+				SendOAuthError(c, http.StatusBadRequest, "invalid_scope", "requested scope exceeds the client permissions")
+				return
+			}
+		}
+		scope = requested
+	}
+
+	audience, format, ok := accessTokenTarget(c, client, c.PostForm("resource"))
+	if !ok {
+		return
+	}
+
+	accessToken, err := oauth.CreateToken(oauth.Token{
+		ClientID: client.ID.Hex(),
+		Scope:    scope,
+		Audience: audience,
+		Format:   format,
+		JKT:      dpopJKT(c),
+	})
+	if err != nil {
+		sendServerError(c)
+		fmt.Printf("CreateToken err: %s\n", err.Error())
+		return
+	}
+
+	tokenObj, exists := oauth.GetToken(accessToken)
+	if !exists {
+		sendServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": accessToken,
+		"token_type":   tokenObj.TokenType(),
+		"expires_in":   int(time.Until(tokenObj.Exp).Seconds()),
+		"scope":        strings.Join(tokenObj.Scope, " "),
+	})
+}
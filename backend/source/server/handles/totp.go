@@ -6,6 +6,7 @@ import (
 	"nyauth_backed/source/database"
 	"nyauth_backed/source/helper"
 	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -175,10 +176,16 @@ func VerifyTOTP(c *gin.Context) {
 
 	// 验证通过，生成JWT
 	exp := int64(60 * 60 * 24)
+	sessionID, err := oauth.NewSessionID()
+	if err != nil {
+		SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("生成token失败: %s", err.Error()), nil)
+		return
+	}
 	token, err := helper.JwtHelper.IssueToken(map[string]interface{}{
-		"user_name": user.Username,
-		"user_id":   user.UserID.Hex(),
-		"role":      user.Role,
+		"user_name":  user.Username,
+		"user_id":    user.UserID.Hex(),
+		"role":       user.Role,
+		"session_id": sessionID,
 	}, "user", exp)
 	if err != nil {
 		SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("生成token失败: %s", err.Error()), nil)
@@ -8,6 +8,7 @@ import (
 	"nyauth_backed/source/helper"
 	"nyauth_backed/source/logger"
 	"nyauth_backed/source/models"
+	"nyauth_backed/source/oauth"
 	"nyauth_backed/source/untils"
 
 	"github.com/gin-gonic/gin"
@@ -90,10 +91,18 @@ func UserLogin(c *gin.Context) {
 
 	exp := int64(60 * 60 * 24)
 
+	// 每次登录开启新的会话，用于登出时通知授权过的应用
+	sessionID, err := oauth.NewSessionID()
+	if err != nil {
+		SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("issue token err: %s", err.Error()), nil)
+		return
+	}
+
 	token, err := helper.JwtHelper.IssueToken(map[string]interface{}{
-		"user_name": user.Username,
-		"user_id":   user.UserID,
-		"role":      user.Role,
+		"user_name":  user.Username,
+		"user_id":    user.UserID,
+		"role":       user.Role,
+		"session_id": sessionID,
 	}, "user", exp)
 	if err != nil {
 		SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("issue token err: %s", err.Error()), nil)
@@ -141,10 +150,16 @@ func UserRegister(c *gin.Context) {
 
 	// 生成 JWT token
 	exp := int64(60 * 60 * 24)
+	sessionID, err := oauth.NewSessionID()
+	if err != nil {
+		SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("issue token err: %s", err.Error()), nil)
+		return
+	}
 	token, err := helper.JwtHelper.IssueToken(map[string]interface{}{
-		"user_name": creds.Username,
-		"user_id":   userId,
-		"role":      "user",
+		"user_name":  creds.Username,
+		"user_id":    userId,
+		"role":       "user",
+		"session_id": sessionID,
 	}, "user", exp)
 	if err != nil {
 		SendResponse(c, http.StatusInternalServerError, fmt.Sprintf("issue token err: %s", err.Error()), nil)
@@ -1,11 +1,15 @@
 package handles
 
 import (
+	"errors"
 	"net/http"
 	"nyauth_backed/source/helper"
+	"nyauth_backed/source/oauth"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type Response struct {
@@ -54,8 +58,118 @@ func JWTMiddleware(audience string) gin.HandlerFunc {
 			return
 		}
 
+		// 已登出的会话不能继续使用
+		if sessionID, _ := sessionClaims(token.Claims); sessionID != "" && oauth.IsSessionEnded(sessionID) {
+			SendResponse(c, http.StatusUnauthorized, "session has ended", nil)
+			c.Abort()
+			return
+		}
+
 		// 将 claims 存储在上下文中
 		c.Set("jwtClaims", token.Claims)
 		c.Next()
 	}
 }
+
+// OptionalJWTMiddleware 与 JWTMiddleware 相同，但未登录或 JWT 无效时不拦截请求，由处理函数自行判断
+func OptionalJWTMiddleware(audience string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := helper.JwtHelper.VerifyToken(bearerToken(c), audience)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// 已登出的会话视为未登录
+		if sessionID, _ := sessionClaims(token.Claims); sessionID != "" && oauth.IsSessionEnded(sessionID) {
+			c.Next()
+			return
+		}
+
+		c.Set("jwtClaims", token.Claims)
+		c.Next()
+	}
+}
+
+// portalSession 返回门户 JWT 中的登录会话ID与过期时间，旧版 JWT 没有会话ID
+func portalSession(c *gin.Context) (string, time.Time) {
+	claims, exists := c.Get("jwtClaims")
+	if !exists {
+		return "", time.Time{}
+	}
+	return sessionClaims(claims.(jwt.Claims))
+}
+
+// sessionClaims 从门户 JWT 的声明中读取会话ID与过期时间
+func sessionClaims(claims jwt.Claims) (string, time.Time) {
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return "", time.Time{}
+	}
+	data, _ := mapClaims["data"].(map[string]interface{})
+	sessionID, _ := data["session_id"].(string)
+
+	exp, err := mapClaims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return sessionID, time.Time{}
+	}
+	return sessionID, exp.Time
+}
+
+// OAuthTokenMiddleware 验证 OAuth 访问令牌的 Gin 中间件，供第三方应用调用的接口使用
+// 绑定了 DPoP 公钥的令牌必须使用 DPoP 方案出示，并附带与令牌绑定的证明
+func OAuthTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "DPoP") {
+			c.Header("WWW-Authenticate", `Bearer realm="Nyauth"`)
+			SendOAuthError(c, http.StatusUnauthorized, "invalid_request", "authorization header format must be Bearer {token}")
+			c.Abort()
+			return
+		}
+
+		token, exists := oauth.GetToken(parts[1])
+		if !exists {
+			c.Header("WWW-Authenticate", parts[0]+` realm="Nyauth", error="invalid_token"`)
+			SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "access token is invalid or expired")
+			c.Abort()
+			return
+		}
+
+		// 令牌类型与出示方案必须一致，DPoP 令牌还需验证持有对应的私钥
+		if parts[0] != token.TokenType() {
+			c.Header("WWW-Authenticate", token.TokenType()+` realm="Nyauth", error="invalid_token"`)
+			SendOAuthError(c, http.StatusUnauthorized, "invalid_token", "access token must be presented with the "+token.TokenType()+" scheme")
+			c.Abort()
+			return
+		}
+		if token.JKT != "" {
+			jkt, err := verifyDPoPProof(c, parts[1])
+			if err == nil && jkt == "" {
+				err = errors.New("DPoP proof is required")
+			} else if err == nil && jkt != token.JKT {
+				err = errors.New("proof is not signed by the key bound to the access token")
+			}
+			if err != nil {
+				c.Header("WWW-Authenticate", `DPoP realm="Nyauth", error="invalid_dpop_proof", algs="`+strings.Join(helper.ClientSigningAlgs, " ")+`"`)
+				SendOAuthError(c, http.StatusUnauthorized, "invalid_dpop_proof", err.Error())
+				c.Abort()
+				return
+			}
+		}
+
+		// 将令牌信息存储在上下文中
+		c.Set("oauthToken", token)
+		c.Next()
+	}
+}
+
+// bearerToken 从 Authorization 请求头中取出 Bearer 令牌，格式不正确时返回空字符串
+func bearerToken(c *gin.Context) string {
+	parts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return ""
+	}
+	return parts[1]
+}
@@ -84,17 +84,69 @@ func initRouter(r *gin.Engine) *gin.Engine {
 				// 创建多用户身份
 				multiAccount.POST("/create", handles.CreateMultiIdentity)
 			}
+
+			// 已授权的应用
+			authorizations := account.Group("/authorizations")
+			{
+				// 获取授权过的应用
+				authorizations.GET("", handles.GetAuthorizedApps)
+				// 撤销授权
+				authorizations.DELETE("/:client_id", handles.RevokeAuthorizedApp)
+			}
+
+			// 开发者应用管理
+			clients := account.Group("/clients")
+			{
+				// 获取自己创建的应用
+				clients.GET("", handles.GetClients)
+				// 创建应用
+				clients.POST("", handles.CreateClient)
+				// 更新应用信息
+				clients.PUT("/:client_id", handles.UpdateClient)
+				// 停用与启用应用
+				clients.POST("/:client_id/disable", handles.DisableClient)
+				clients.POST("/:client_id/enable", handles.EnableClient)
+				// 轮换与吊销应用密钥
+				clients.POST("/:client_id/secrets", handles.RotateClientSecret)
+				clients.DELETE("/:client_id/secrets/:secret_id", handles.RevokeClientSecret)
+				// 删除应用
+				clients.DELETE("/:client_id", handles.DeleteClient)
+			}
 		}
 
 		oauth := api.Group("/oauth")
 		{
+			// 授权端点在未登录时也需要处理 prompt=none
+			oauth.GET("/authorize", handles.OptionalJWTMiddleware("user"), handles.OAuthAuthorize)
+
 			oauthProtected := oauth.Group("", handles.JWTMiddleware("user"))
 			{
-				oauthProtected.GET("/authorize", handles.OAuthAuthorize)
 				oauthProtected.POST("/getclientinfo", handles.GetClientinfo)
+				// 用户输入用户码确认设备授权
+				oauthProtected.GET("/device/verify", handles.GetDeviceVerification)
+				oauthProtected.POST("/device/verify", handles.DeviceVerification)
 			}
 
 			oauth.POST("/token", handles.OAuthToken)
+			oauth.POST("/device_authorization", handles.OAuthDeviceAuthorization)
+			oauth.POST("/par", handles.OAuthPushedAuthorization)
+			oauth.POST("/introspect", handles.OAuthIntrospect)
+			// 登出，未登录时同样可以调用
+			oauth.POST("/endsession", handles.EndSession)
+			oauth.POST("/revoke", handles.OAuthRevoke)
+
+			// 动态客户端注册
+			register := oauth.Group("/register")
+			{
+				register.POST("", handles.RegisterClient)
+				register.GET("/:client_id", handles.GetRegisteredClient)
+				register.PUT("/:client_id", handles.UpdateRegisteredClient)
+				register.DELETE("/:client_id", handles.DeleteRegisteredClient)
+			}
+
+			// OIDC UserInfo，使用 OAuth 访问令牌鉴权
+			oauth.GET("/userinfo", handles.OAuthTokenMiddleware(), handles.OIDCUserInfo)
+			oauth.POST("/userinfo", handles.OAuthTokenMiddleware(), handles.OIDCUserInfo)
 		}
 	}
 	return r
@@ -0,0 +1,11 @@
+package untils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+func SHA256(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
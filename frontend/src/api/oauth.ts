@@ -6,11 +6,25 @@ export interface OAuthAuthorizeParams {
     response_type: string
     scope: string
     state: string
-    user_id?: string
+    code_challenge?: string
+    code_challenge_method?: string
+    request_uri?: string
+    request?: string
+    prompt?: string
+    max_age?: string
+    login_hint?: string
+    id_token_hint?: string
+    identity_id?: string
+    login_state?: string
+    approved?: boolean
 }
 
 export interface OAuthAuthorizeResponse {
     redirect_url: string
+    login_required?: boolean
+    login_hint?: string
+    login_state?: string
+    consent_required?: boolean
 }
 
 export const getOAuthAuthorize = (params: OAuthAuthorizeParams) => {
@@ -19,7 +33,16 @@ export const getOAuthAuthorize = (params: OAuthAuthorizeParams) => {
     })
 }
 
-export const getClientInfo = (data: { client_id: string }) => {
+export const getClientInfo = (data: {
+    client_id: string
+    scope?: string
+    request_uri?: string
+    prompt?: string
+    max_age?: string
+    login_hint?: string
+    id_token_hint?: string
+    login_state?: string
+}) => {
     return axios.post<
         Response<{
             avatar: string
@@ -30,6 +53,46 @@ export const getClientInfo = (data: { client_id: string }) => {
             created_by: string
             status: number
             permissions: string[]
+            consent_granted?: boolean
+            login_required?: boolean
+            login_state?: string
+            identity_id?: string
         }>
     >('/oauth/getclientinfo', data)
 }
+
+export interface DeviceVerificationInfo {
+    user_code: string
+    client_id: string
+    client_name: string
+    description: string
+    avatar: string
+    scope: string[]
+    expires_at: number
+}
+
+export const getDeviceVerification = (params: { user_code: string }) => {
+    return axios.get<Response<DeviceVerificationInfo>>('/oauth/device/verify', {
+        params
+    })
+}
+
+export const verifyDevice = (data: { user_code: string; approve: boolean }) => {
+    return axios.post<Response>('/oauth/device/verify', data)
+}
+
+export interface EndSessionParams {
+    id_token_hint?: string
+    client_id?: string
+    post_logout_redirect_uri?: string
+    state?: string
+}
+
+export interface EndSessionResponse {
+    redirect_url: string
+    frontchannel_logout_uris: string[]
+}
+
+export const endSession = (data: EndSessionParams) => {
+    return axios.post<Response<EndSessionResponse>>('/oauth/endsession', data)
+}
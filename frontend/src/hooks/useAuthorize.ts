@@ -1,13 +1,23 @@
 import { ref, computed, onMounted } from 'vue'
-import { getClientInfo, getOAuthAuthorize, type OAuthAuthorizeParams } from '@/api/oauth'
+import type { AxiosError } from 'axios'
+import {
+    getClientInfo,
+    getOAuthAuthorize,
+    type OAuthAuthorizeParams,
+    type OAuthAuthorizeResponse
+} from '@/api/oauth'
+import type { Response } from '@/utils/axios'
 import { useRoute } from 'vue-router'
 import { modal } from '@/services/modal'
+import { Cookie } from '@/utils/cookie'
 import router from '@/router'
 import { useMultiAccounts } from '@/hooks/useMultiAccounts'
 
 export interface Identity {
     id: number
     userId: string
+    identityId: string
+    isPrimary: boolean
     userName: string
     email: string
     avatar: string
@@ -25,6 +35,8 @@ export function useIdentities() {
         return accounts.value.map((account, index) => ({
             id: index + 1,
             userId: account.userId || '',
+            identityId: account.identityId || '',
+            isPrimary: account.isPrimary ?? index === 0,
             userName: account.userName || 'Unknown',
             email: account.userId ? `${account.email}` : 'unknown@example.com',
             avatar: account.avatar || 'https://gravatar.com/avatar/ccd1317597a7796d8b5f2b2785e88d5f?d=identicon&s=256',
@@ -42,6 +54,8 @@ export function useIdentities() {
             return {
                 id: selectedIdentityId.value,
                 userId: '',
+                identityId: '',
+                isPrimary: true,
                 userName: 'Loading...',
                 email: 'loading@example.com',
                 avatar: 'https://gravatar.com/avatar/ccd1317597a7796d8b5f2b2785e88d5f?d=identicon&s=256',
@@ -65,6 +79,8 @@ export function useIdentities() {
         return {
             id: selectedIdentityId.value,
             userId: '',
+            identityId: '',
+            isPrimary: true,
             userName: 'Unknown',
             email: 'unknown@example.com',
             avatar: 'https://gravatar.com/avatar/ccd1317597a7796d8b5f2b2785e88d5f?d=identicon&s=256',
@@ -144,6 +160,9 @@ export function useOAuthAuthorize() {
 
     // 初始化 OAuth 流程
     const initOAuthFlow = async () => {
+        let consentGranted = false
+        // 此前授权时选择的身份，为空时为主账号
+        let storedIdentityId: string | undefined
         try {
             // 获取URL参数
             oauthParams.value = {
@@ -154,6 +173,31 @@ export function useOAuthAuthorize() {
                 state: (route.query.state as string) || ''
             }
 
+            // PKCE 参数原样透传给后端
+            if (route.query.code_challenge) {
+                oauthParams.value.code_challenge = route.query.code_challenge as string
+                oauthParams.value.code_challenge_method =
+                    (route.query.code_challenge_method as string) || undefined
+            }
+
+            // 使用 PAR 时其余参数由后端从推送的请求中读取
+            if (route.query.request_uri) {
+                oauthParams.value.request_uri = route.query.request_uri as string
+            }
+
+            // 签名的请求对象原样透传，由后端验证
+            if (route.query.request) {
+                oauthParams.value.request = route.query.request as string
+            }
+
+            // OIDC 认证相关参数，由后端判断是否需要重新登录
+            // login_state 由后端在要求重新登录时签发，用于确认用户已在授权请求之后登录
+            for (const key of ['prompt', 'max_age', 'login_hint', 'id_token_hint', 'login_state'] as const) {
+                if (route.query[key]) {
+                    oauthParams.value[key] = route.query[key] as string
+                }
+            }
+
             // 验证必要参数是否存在
             if (!oauthParams.value.client_id) {
                 const choice = await modal.error<string>({
@@ -174,11 +218,30 @@ export function useOAuthAuthorize() {
                 return
             }
 
+            // prompt=none 时不展示任何页面，直接由后端判断并带回结果
+            if (isSilent()) {
+                await handleSilentAuthorize()
+                return
+            }
+
             // 请求应用信息
             const { data: clientResponse } = await getClientInfo({
-                client_id: oauthParams.value.client_id
+                client_id: oauthParams.value.client_id,
+                scope: oauthParams.value.scope,
+                request_uri: oauthParams.value.request_uri,
+                prompt: oauthParams.value.prompt,
+                max_age: oauthParams.value.max_age,
+                login_hint: oauthParams.value.login_hint,
+                id_token_hint: oauthParams.value.id_token_hint,
+                login_state: oauthParams.value.login_state
             })
 
+            // 当前登录不满足应用的要求，先重新登录
+            if (clientResponse?.data?.login_required) {
+                redirectToLogin(undefined, clientResponse.data.login_state)
+                return
+            }
+
             if (clientResponse && clientResponse.data !== undefined) {
                 // 更新应用信息
                 appInfo.value = {
@@ -202,6 +265,13 @@ export function useOAuthAuthorize() {
                         description: `允许应用${permParts[1] === 'read' ? '读取' : '修改'}您的${permParts[0]}`
                     }
                 })
+
+                storedIdentityId = clientResponse.data.identity_id
+
+                // 之前已经同意过这些权限，无需再次确认
+                if (clientResponse.data.consent_granted) {
+                    consentGranted = true
+                }
             } else {
                 modal.error({
                     title: '出错惹',
@@ -217,10 +287,31 @@ export function useOAuthAuthorize() {
         } finally {
             loading.value = false
         }
+
+        // 默认选中此前授权时选择的身份
+        // 身份列表尚未加载完成或该身份已不存在时仍然展示确认页面
+        const storedIdentityFound = storedIdentityId !== undefined && selectIdentity(storedIdentityId)
+        if (consentGranted && storedIdentityFound) {
+            await authorize(false)
+        }
     }
 
-    // 处理授权操作
-    const handleAuthorize = async () => {
+    // 选中指定的身份，身份ID为空时选中主账号，返回是否找到该身份
+    const selectIdentity = (identityId: string) => {
+        const found = identities.value.find((identity) =>
+            identityId ? identity.identityId === identityId : identity.isPrimary
+        )
+        if (found) {
+            selectedIdentityId.value = found.id
+        }
+        return found !== undefined
+    }
+
+    // 用户在确认页面点击同意
+    const handleAuthorize = () => authorize(true)
+
+    // 处理授权操作，approved 表示用户是否在确认页面同意，为 false 时由后端检查此前的授权
+    const authorize = async (approved: boolean) => {
         try {
             // 设置处理中状态
             authProcessing.value = true
@@ -232,10 +323,11 @@ export function useOAuthAuthorize() {
             }
 
             console.log(identityInfo)
-            // 发送授权请求，包含身份ID
+            // 发送授权请求时总是附带所选身份ID，主账号的身份ID即用户ID，应用只能看到该身份的信息
             const authorizeParams = {
                 ...oauthParams.value,
-                user_id: identityInfo.userId
+                identity_id: identityInfo.identityId,
+                approved: approved || undefined
             }
             const { data: response } = await getOAuthAuthorize(authorizeParams)
             
@@ -265,6 +357,28 @@ export function useOAuthAuthorize() {
         } catch (err) {
             console.error('授权请求失败:', err)
             authProcessing.value = false
+
+            const errorData = (err as AxiosError<Response<OAuthAuthorizeResponse>>).response?.data
+                ?.data
+
+            // 需要重新登录，登录后重新发起授权
+            if (errorData?.login_required) {
+                redirectToLogin(errorData.login_hint, errorData.login_state)
+                return
+            }
+
+            // 此前的授权已不足以跳过确认，展示确认页面由用户同意
+            if (errorData?.consent_required) {
+                return
+            }
+
+            // 重定向URI验证通过后的错误需要带回应用
+            const errorRedirect = errorData?.redirect_url
+            if (errorRedirect) {
+                window.location.href = errorRedirect
+                return
+            }
+
             error.value = '授权请求失败，请稍后再试'
             modal.error({
                 title: '授权失败',
@@ -273,6 +387,49 @@ export function useOAuthAuthorize() {
         }
     }
 
+    // 是否为 prompt=none 的静默授权
+    const isSilent = () => (oauthParams.value.prompt || '').split(' ').includes('none')
+
+    // 静默授权，成功或失败都直接跳转回应用
+    const handleSilentAuthorize = async () => {
+        try {
+            const { data: response } = await getOAuthAuthorize(oauthParams.value)
+            if (response?.data?.redirect_url) {
+                window.location.href = response.data.redirect_url
+            }
+        } catch (err) {
+            const errorRedirect = (err as AxiosError<Response<OAuthAuthorizeResponse>>).response
+                ?.data?.data?.redirect_url
+            if (errorRedirect) {
+                window.location.href = errorRedirect
+                return
+            }
+            console.error('静默授权失败:', err)
+            error.value = '授权请求失败，请稍后再试'
+        }
+    }
+
+    // 清除登录状态并跳转到登录页面，登录完成后回到授权页面
+    // 回到授权页面时带上后端签发的 login_state，由后端确认用户已重新登录
+    const redirectToLogin = (loginHint?: string, loginState?: string) => {
+        Cookie.remove('token')
+        Cookie.remove('tokenExpiry')
+        Cookie.remove('rememberMe')
+
+        const query = { ...route.query }
+        if (loginState) {
+            query.login_state = loginState
+        }
+
+        router.push({
+            name: 'Login',
+            query: {
+                redirect: router.resolve({ name: 'Authorize', query }).fullPath,
+                login_hint: loginHint || oauthParams.value.login_hint
+            }
+        })
+    }
+
     // 处理拒绝操作
     const handleReject = () => {
         // 拒绝授权，可以返回到固定页面或带错误信息跳转到redirect_uri
@@ -0,0 +1,60 @@
+import { ref } from 'vue'
+import { useRoute } from 'vue-router'
+import {
+    getDeviceVerification,
+    verifyDevice,
+    type DeviceVerificationInfo
+} from '@/api/oauth'
+
+export function useDeviceAuthorize() {
+    const route = useRoute()
+
+    // 用户输入的用户码，可由 verification_uri_complete 预先填写
+    const userCode = ref((route.query.user_code as string) || '')
+    // 待确认的设备授权信息
+    const deviceInfo = ref<DeviceVerificationInfo | null>(null)
+    // 请求处理中状态
+    const processing = ref(false)
+    // 授权结果: approved 已同意, denied 已拒绝
+    const result = ref<'' | 'approved' | 'denied'>('')
+
+    // 查询用户码对应的设备授权
+    const lookupUserCode = async () => {
+        if (!userCode.value) return
+        processing.value = true
+        try {
+            const { data: response } = await getDeviceVerification({
+                user_code: userCode.value
+            })
+            deviceInfo.value = response.data ?? null
+        } catch (err) {
+            console.error('获取设备授权信息失败:', err)
+            deviceInfo.value = null
+        } finally {
+            processing.value = false
+        }
+    }
+
+    // 同意或拒绝设备授权
+    const completeVerification = async (approve: boolean) => {
+        if (!deviceInfo.value) return
+        processing.value = true
+        try {
+            await verifyDevice({ user_code: deviceInfo.value.user_code, approve })
+            result.value = approve ? 'approved' : 'denied'
+        } catch (err) {
+            console.error('设备授权失败:', err)
+        } finally {
+            processing.value = false
+        }
+    }
+
+    return {
+        userCode,
+        deviceInfo,
+        processing,
+        result,
+        lookupUserCode,
+        completeVerification
+    }
+}
@@ -7,8 +7,10 @@ import { Cookie } from '@/utils/cookie'
 
 // 表单状态和验证管理
 export function useLoginForm() {
+    const route = useRoute()
     const form = ref<InstanceType<typeof VForm>>()
-    const email = ref('')
+    // 应用通过 login_hint 提示的账号
+    const email = ref((route.query.login_hint as string) || '')
     const password = ref('')
     const otp = ref('')
     const totpCode = ref('') // 添加TOTP验证码
@@ -0,0 +1,90 @@
+import { ref } from 'vue'
+import { useRoute } from 'vue-router'
+import { endSession } from '@/api/oauth'
+import { Cookie } from '@/utils/cookie'
+import router from '@/router'
+
+// 等待前端登出地址加载的最长时间
+const FRONTCHANNEL_TIMEOUT = 5000
+
+export function useLogout() {
+    const route = useRoute()
+
+    // 需要由浏览器加载的应用前端登出地址
+    const frontchannelUris = ref<string[]>([])
+    // 请求处理中状态
+    const processing = ref(false)
+    // 登出完成状态
+    const loggedOut = ref(false)
+
+    // 已加载完成的前端登出地址数量
+    let loadedCount = 0
+    // 前端登出地址全部加载完成后执行的跳转
+    let finish: (() => void) | null = null
+
+    // 前端登出地址加载完成
+    const onFrontchannelLoaded = () => {
+        loadedCount++
+        if (loadedCount >= frontchannelUris.value.length && finish) {
+            finish()
+        }
+    }
+
+    // 确认退出登录
+    const logout = async () => {
+        processing.value = true
+        try {
+            const { data: response } = await endSession({
+                id_token_hint: (route.query.id_token_hint as string) || undefined,
+                client_id: (route.query.client_id as string) || undefined,
+                post_logout_redirect_uri:
+                    (route.query.post_logout_redirect_uri as string) || undefined,
+                state: (route.query.state as string) || undefined
+            })
+
+            // 清除本地的登录状态
+            Cookie.remove('token')
+            Cookie.remove('tokenExpiry')
+            Cookie.remove('rememberMe')
+            loggedOut.value = true
+
+            const redirectUrl = response.data?.redirect_url
+            let done = false
+            finish = () => {
+                if (done) return
+                done = true
+                if (redirectUrl) {
+                    window.location.href = redirectUrl
+                } else {
+                    router.push({ name: 'Login' })
+                }
+            }
+
+            // 先通知各应用登出，全部加载完成或超时后再跳转
+            frontchannelUris.value = response.data?.frontchannel_logout_uris ?? []
+            if (frontchannelUris.value.length === 0) {
+                finish()
+            } else {
+                setTimeout(finish, FRONTCHANNEL_TIMEOUT)
+            }
+        } catch (err) {
+            console.error('退出登录失败:', err)
+        } finally {
+            processing.value = false
+        }
+    }
+
+    // 取消退出登录
+    const cancel = () => {
+        router.push({ name: 'Home' })
+    }
+
+    return {
+        frontchannelUris,
+        processing,
+        loggedOut,
+        logout,
+        cancel,
+        onFrontchannelLoaded
+    }
+}
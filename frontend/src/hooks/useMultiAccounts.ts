@@ -7,6 +7,8 @@ export interface MultiAccount {
     lastActiveTime: string
     tagText: string
     userId?: string
+    identityId?: string
+    isPrimary?: boolean
     email?: string
 }
 
@@ -37,6 +39,8 @@ export function useMultiAccounts() {
                         lastActiveTime,
                         tagText,
                         userId: identity.uuid,
+                        identityId: identity.identity_id,
+                        isPrimary: identity.is_primary,
                         email: identity.email
                     }
                 })
@@ -61,6 +61,16 @@ const router = createRouter({
                     path: 'authorize',
                     name: 'Authorize',
                     component: () => import('@/pages/Authorize/Authorize.vue')
+                },
+                {
+                    path: 'device',
+                    name: 'Device',
+                    component: () => import('@/pages/Authorize/Device.vue')
+                },
+                {
+                    path: 'logout',
+                    name: 'Logout',
+                    component: () => import('@/pages/Authorize/Logout.vue')
                 }
             ]
         }
@@ -69,11 +79,16 @@ const router = createRouter({
 
 // 全局前置守卫
 router.beforeEach((to, from, next) => {
-    // 检查 path 是否为 /console 或者 /oauth
-    if (to.path.startsWith('/console') || to.path.startsWith('/oauth')) {
+    // 检查 path 是否为 /console 或者 /oauth，登出页面未登录时也可以访问
+    if ((to.path.startsWith('/console') || to.path.startsWith('/oauth')) && to.name !== 'Logout') {
         // 验证是否存在 token
         const token = Cookie.get('token')
-        if (!token) {
+        // prompt=none 的授权请求不能展示登录页面，交由后端返回 login_required
+        const silent =
+            to.name === 'Authorize' &&
+            typeof to.query.prompt === 'string' &&
+            to.query.prompt.split(' ').includes('none')
+        if (!token && !silent) {
             // 无token，重定向到登录页
             next({
                 name: 'Login',